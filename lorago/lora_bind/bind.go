@@ -1,10 +1,18 @@
 package lora_bind
 
-import "net/http"
+import (
+	"fmt"
+	"github.com/LorraineWen/lorago/lora_render"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
 
 /*
 *@Author: LorraineWen
 *绑定器接口，后续可以支持对各类格式参数的校验
+*根据请求的Content-Type自动选择绑定器，可以通过RegisterBinder注册新的媒体类型
  */
 type Binder interface {
 	Name() string
@@ -17,3 +25,71 @@ func validateAllParams(data any) error {
 
 var JsonBinder = jsonBinder{}
 var XmlBinder = xmlBinder{}
+var FormBinder = formBinder{}
+var FormMultipartBinder = formMultipartBinder{}
+var QueryBinder = queryBinder{}
+var HeaderBinder = headerBinder{}
+var CookieBinder = cookieBinder{}
+var UriBinder = uriBinder{}
+var ProtoBufBinder = protobufBinder{}
+var MsgPackBinder = msgpackBinder{}
+var YamlBinder = yamlBinder{}
+var TomlBinder = tomlBinder{}
+
+// 媒体类型对应的绑定器
+var binders = map[string]Binder{
+	lora_render.MIMEJSON:              JsonBinder,
+	lora_render.MIMEXML:               XmlBinder,
+	lora_render.MIMEXML2:              XmlBinder,
+	lora_render.MIMEPOSTForm:          FormBinder,
+	lora_render.MIMEMultipartPOSTForm: FormMultipartBinder,
+	lora_render.MIMEPROTOBUF:          ProtoBufBinder,
+	lora_render.MIMEPROTOBUF2:         ProtoBufBinder,
+	lora_render.MIMEMSGPACK:           MsgPackBinder,
+	lora_render.MIMEMSGPACK2:          MsgPackBinder,
+	lora_render.MIMEMSGPACK3:          MsgPackBinder,
+	lora_render.MIMEYAML:              YamlBinder,
+	lora_render.MIMEYAML2:             YamlBinder,
+	lora_render.MIMEYAML3:             YamlBinder,
+	lora_render.MIMETOML:              TomlBinder,
+}
+var bindersLock sync.RWMutex
+
+// 请求的Content-Type不支持时返回的错误，对应415状态码
+type UnsupportedMediaTypeError struct {
+	ContentType string
+}
+
+func (e *UnsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("unsupported media type [%s]", e.ContentType)
+}
+
+func (e *UnsupportedMediaTypeError) StatusCode() int {
+	return http.StatusUnsupportedMediaType
+}
+
+// 注册媒体类型对应的绑定器，已经存在的会被覆盖
+// 调用方式:lora_bind.RegisterBinder("application/x-yaml", yamlBinder)
+func RegisterBinder(mediaType string, binder Binder) {
+	bindersLock.Lock()
+	defer bindersLock.Unlock()
+	binders[strings.ToLower(mediaType)] = binder
+}
+
+// 根据请求方法和Content-Type选择绑定器，GET请求绑定请求路径中的参数
+func Default(method, contentType string) (Binder, error) {
+	if method == http.MethodGet {
+		return QueryBinder, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, &UnsupportedMediaTypeError{ContentType: contentType}
+	}
+	bindersLock.RLock()
+	defer bindersLock.RUnlock()
+	binder, ok := binders[mediaType]
+	if !ok {
+		return nil, &UnsupportedMediaTypeError{ContentType: contentType}
+	}
+	return binder, nil
+}
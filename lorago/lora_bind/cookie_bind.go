@@ -0,0 +1,40 @@
+package lora_bind
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+/*
+*@Author: LorraineWen
+*定义cookie绑定器，通过cookie标签指定cookie名称
+*cookie的值会进行url解码，和Context.SetCookie的编码方式对应
+ */
+type cookieBinder struct{}
+
+func (cookieBinder) Name() string {
+	return "cookie"
+}
+
+func (cookieBinder) Bind(req *http.Request, obj any) error {
+	if req == nil {
+		return errors.New("请求错误")
+	}
+	if err := cookieMapping(req, false).mapTo(obj); err != nil {
+		return err
+	}
+	return validateAllParams(obj)
+}
+
+func cookieMapping(req *http.Request, requireTag bool) formMapping {
+	values := make(map[string][]string)
+	for _, cookie := range req.Cookies() {
+		value, err := url.QueryUnescape(cookie.Value)
+		if err != nil {
+			value = cookie.Value
+		}
+		values[cookie.Name] = append(values[cookie.Name], value)
+	}
+	return formMapping{values: values, tags: []string{"cookie"}, requireTag: requireTag}
+}
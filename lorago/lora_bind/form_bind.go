@@ -0,0 +1,84 @@
+package lora_bind
+
+import (
+	"errors"
+	"mime/multipart"
+	"net/http"
+)
+
+/*
+*@Author: LorraineWen
+*定义表单绑定器，支持application/x-www-form-urlencoded和multipart/form-data
+*通过form标签指定表单中的参数名称，multipart表单支持绑定上传文件
+*绑定完成之后和其他绑定器一样进行第三方校验
+*IsValidate为true时检查binding:"required"的属性是否存在，和json绑定器一致
+ */
+// 解析multipart表单时默认最多加载到内存中的大小，超过的部分会存放到临时文件中
+const DefaultMultipartMemory = 30 << 20
+
+// MaxMemory为0时使用DefaultMultipartMemory，通过Context绑定时使用engine.SetMaxMultipartMemory设置的值
+type formBinder struct {
+	MaxMemory  int64
+	IsValidate bool
+}
+
+type formMultipartBinder struct {
+	MaxMemory  int64
+	IsValidate bool
+}
+
+func multipartMemory(maxMemory int64) int64 {
+	if maxMemory > 0 {
+		return maxMemory
+	}
+	return DefaultMultipartMemory
+}
+
+func (formBinder) Name() string {
+	return "form"
+}
+
+// 请求路径中的参数和请求体中的表单参数都会被绑定，同名时请求体中的参数优先
+func (b formBinder) Bind(req *http.Request, obj any) error {
+	if req == nil {
+		return errors.New("请求错误")
+	}
+	if err := req.ParseMultipartForm(multipartMemory(b.MaxMemory)); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return err
+	}
+	if err := mapFormWithFiles(obj, req.Form, multipartFiles(req), "form", b.IsValidate); err != nil {
+		return err
+	}
+	return validateAllParams(obj)
+}
+
+func (formMultipartBinder) Name() string {
+	return "multipart/form-data"
+}
+
+// 调用方式:
+//
+//	type Upload struct {
+//		Name   string                  `form:"name"`
+//		Avatar *multipart.FileHeader   `form:"avatar"`
+//		Photos []*multipart.FileHeader `form:"photos"`
+//	}
+func (b formMultipartBinder) Bind(req *http.Request, obj any) error {
+	if req == nil {
+		return errors.New("请求错误")
+	}
+	if err := req.ParseMultipartForm(multipartMemory(b.MaxMemory)); err != nil {
+		return err
+	}
+	if err := mapFormWithFiles(obj, req.Form, multipartFiles(req), "form", b.IsValidate); err != nil {
+		return err
+	}
+	return validateAllParams(obj)
+}
+
+func multipartFiles(req *http.Request) map[string][]*multipart.FileHeader {
+	if req.MultipartForm == nil {
+		return nil
+	}
+	return req.MultipartForm.File
+}
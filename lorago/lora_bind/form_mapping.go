@@ -0,0 +1,401 @@
+package lora_bind
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*将map[string][]string格式的参数(表单，请求路径参数，请求头，cookie，路由参数)映射到结构体
+*通过结构体标签指定参数名称，没有标签时使用属性名称，标签为"-"时忽略该属性
+*支持int，float，bool，string，切片，time.Time(通过time_format标签指定格式)
+*支持user[name]格式的嵌套参数，结构体属性的参数名称会作为前缀，只有存在该前缀的参数时才会映射
+*匿名嵌入的结构体属性没有前缀，它的属性和当前结构体的属性使用同一级的参数
+*支持*multipart.FileHeader和[]*multipart.FileHeader类型的上传文件
+*支持default标签设置参数不存在时的默认值，切片的默认值用逗号分隔，default:"1,2,3"
+*validateRequired为true时检查binding:"required"的属性，参数不存在并且没有默认值时返回ValidationErrors，和json绑定器一致
+ */
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	fileHeaderType = reflect.TypeOf(multipart.FileHeader{})
+)
+
+// 描述一次映射:从哪里取值，使用哪些标签
+type formMapping struct {
+	values     map[string][]string
+	files      map[string][]*multipart.FileHeader
+	tags       []string            //按顺序查找的标签，使用第一个存在的标签
+	requireTag bool                //为true时只映射带有标签的属性，多个来源绑定同一个结构体时使用
+	keyFunc    func(string) string //参数名称的转换函数，比如请求头需要转换为规范格式
+	//为true时记录缺少的binding:"required"属性，通过Context.Validate开启
+	validateRequired bool
+	missing          *ValidationErrors
+}
+
+func mapFormByTag(data any, values map[string][]string, tag string) error {
+	return mapFormWithFiles(data, values, nil, tag, false)
+}
+
+func mapFormWithFiles(data any, values map[string][]string, files map[string][]*multipart.FileHeader, tag string, validateRequired bool) error {
+	return formMapping{values: values, files: files, tags: []string{tag}, validateRequired: validateRequired}.mapTo(data)
+}
+
+func (m formMapping) mapTo(data any) error {
+	valueOf := reflect.ValueOf(data)
+	if valueOf.Kind() != reflect.Pointer || valueOf.IsNil() {
+		return errors.New("bind data must be a pointer")
+	}
+	elem := valueOf.Elem()
+	if elem.Kind() != reflect.Struct {
+		return errors.New("bind data must be a struct pointer")
+	}
+	if !m.validateRequired {
+		return m.mapStruct(elem, "", nil)
+	}
+	missing := make(ValidationErrors, 0)
+	m.missing = &missing
+	if err := m.mapStruct(elem, "", nil); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return missing
+	}
+	return nil
+}
+
+// 记录缺少的required属性
+func (m formMapping) checkRequired(field reflect.StructField, key string) {
+	if m.missing != nil && isRequired(field) {
+		*m.missing = append(*m.missing, newFieldError(key, "required", ""))
+	}
+}
+
+// 查找属性的参数名称，ok为false表示该属性不参与映射
+func (m formMapping) fieldName(field reflect.StructField) (name string, ok bool) {
+	for _, tag := range m.tags {
+		if name, exist := field.Tag.Lookup(tag); exist {
+			return name, name != "-"
+		}
+	}
+	//匿名嵌入的结构体没有自己的参数名称，不需要标签
+	if m.requireTag && !(field.Anonymous && isStructField(field.Type)) {
+		return "", false
+	}
+	return "", true
+}
+
+func (m formMapping) lookup(key string) ([]string, bool) {
+	if m.keyFunc != nil {
+		key = m.keyFunc(key)
+	}
+	values, ok := m.values[key]
+	return values, ok && len(values) > 0
+}
+
+// prefix是外层结构体属性的参数名称，内层属性的参数名称为prefix[name]
+// flattened是使用同一个prefix正在映射的结构体类型，匿名嵌入自身的结构体不会无限递归
+func (m formMapping) mapStruct(structValue reflect.Value, prefix string, flattened map[reflect.Type]bool) error {
+	structType := structValue.Type()
+	if flattened[structType] {
+		return nil
+	}
+	if flattened == nil {
+		flattened = make(map[reflect.Type]bool)
+	}
+	flattened[structType] = true
+	defer delete(flattened, structType)
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, ok := m.fieldName(field)
+		if !ok {
+			continue
+		}
+		fieldValue := structValue.Field(i)
+		if isFileField(field.Type) {
+			if name == "" {
+				name = field.Name
+			}
+			key := formKey(prefix, name)
+			if len(m.files[key]) == 0 {
+				m.checkRequired(field, key)
+			}
+			if err := setFileField(fieldValue, m.files[key]); err != nil {
+				return fmt.Errorf("field [%s]: %w", key, err)
+			}
+			continue
+		}
+		if isStructField(field.Type) {
+			if err := m.mapStructField(fieldValue, field, prefix, name, flattened); err != nil {
+				return err
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		key := formKey(prefix, name)
+		formValues, ok := m.lookup(key)
+		if !ok {
+			defaultValue, hasDefault := field.Tag.Lookup("default")
+			if !hasDefault {
+				m.checkRequired(field, key)
+				continue
+			}
+			if !fieldValue.IsZero() {
+				continue
+			}
+			formValues = []string{defaultValue}
+			if isSliceField(field.Type) {
+				formValues = strings.Split(defaultValue, ",")
+			}
+		}
+		if err := setField(fieldValue, field, formValues); err != nil {
+			return fmt.Errorf("field [%s]: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// 结构体属性只有在存在以自己的参数名称为前缀的参数时才映射，自引用的结构体随着前缀变长一定会结束
+// 没有标签的匿名嵌入结构体使用当前的前缀，通过flattened避免嵌入自身时无限递归
+func (m formMapping) mapStructField(fieldValue reflect.Value, field reflect.StructField, prefix, name string, flattened map[reflect.Type]bool) error {
+	elemType := field.Type
+	if elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	childPrefix := prefix
+	if field.Anonymous && name == "" {
+		if flattened[elemType] {
+			return nil
+		}
+	} else {
+		if name == "" {
+			name = field.Name
+		}
+		childPrefix = formKey(prefix, name)
+		if !m.hasPrefix(childPrefix) {
+			m.checkRequired(field, childPrefix)
+			return nil
+		}
+		flattened = nil
+	}
+	if field.Type.Kind() == reflect.Pointer {
+		if fieldValue.IsNil() {
+			fieldValue.Set(reflect.New(elemType))
+		}
+		fieldValue = fieldValue.Elem()
+	}
+	return m.mapStruct(fieldValue, childPrefix, flattened)
+}
+
+func formKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "[" + name + "]"
+}
+
+// 判断是否存在以prefix开头的参数，避免为没有参数的结构体指针分配内存
+func (m formMapping) hasPrefix(prefix string) bool {
+	for key := range m.values {
+		if len(key) > len(prefix) && key[:len(prefix)] == prefix && key[len(prefix)] == '[' {
+			return true
+		}
+	}
+	for key := range m.files {
+		if len(key) > len(prefix) && key[:len(prefix)] == prefix && key[len(prefix)] == '[' {
+			return true
+		}
+	}
+	return false
+}
+
+func isSliceField(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Slice || t.Kind() == reflect.Array
+}
+
+// time.Time虽然是结构体，但是作为普通的值处理
+func isStructField(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType && t != fileHeaderType
+}
+
+func isFileField(t reflect.Type) bool {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t == fileHeaderType
+}
+
+// 为上传文件属性赋值，支持multipart.FileHeader，*multipart.FileHeader和[]*multipart.FileHeader
+func setFileField(value reflect.Value, headers []*multipart.FileHeader) error {
+	if len(headers) == 0 {
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.Pointer:
+		value.Set(reflect.ValueOf(headers[0]))
+	case reflect.Struct:
+		value.Set(reflect.ValueOf(*headers[0]))
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.Pointer {
+			return fmt.Errorf("unsupported type %s", value.Type())
+		}
+		value.Set(reflect.ValueOf(headers))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// 为结构体属性赋值，切片类型的属性使用所有的值，其余类型使用第一个值
+func setField(value reflect.Value, field reflect.StructField, formValues []string) error {
+	switch value.Kind() {
+	case reflect.Pointer:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return setField(value.Elem(), field, formValues)
+	case reflect.Slice:
+		slice := reflect.MakeSlice(value.Type(), len(formValues), len(formValues))
+		for i, formValue := range formValues {
+			if err := setValue(slice.Index(i), field, formValue); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	case reflect.Array:
+		if len(formValues) != value.Len() {
+			return fmt.Errorf("%q is not valid value for %s", formValues, value.Type())
+		}
+		for i, formValue := range formValues {
+			if err := setValue(value.Index(i), field, formValue); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return setValue(value, field, formValues[0])
+	}
+}
+
+// 将字符串转换为属性对应的类型
+func setValue(value reflect.Value, field reflect.StructField, formValue string) error {
+	if value.Type() == timeType {
+		return setTimeValue(value, field, formValue)
+	}
+	switch value.Kind() {
+	case reflect.Pointer:
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return setValue(value.Elem(), field, formValue)
+	case reflect.String:
+		value.SetString(formValue)
+	case reflect.Bool:
+		if formValue == "" {
+			formValue = "false"
+		}
+		b, err := strconv.ParseBool(formValue)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		//time.Duration支持1s，1m这种格式
+		if value.Type() == reflect.TypeOf(time.Duration(0)) {
+			if d, err := time.ParseDuration(formValue); err == nil {
+				value.SetInt(int64(d))
+				return nil
+			}
+		}
+		if formValue == "" {
+			formValue = "0"
+		}
+		n, err := strconv.ParseInt(formValue, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if formValue == "" {
+			formValue = "0"
+		}
+		n, err := strconv.ParseUint(formValue, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if formValue == "" {
+			formValue = "0"
+		}
+		f, err := strconv.ParseFloat(formValue, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// 解析时间，time_format标签指定格式，默认RFC3339，unix和unixnano表示时间戳
+// time_utc:"1"表示使用UTC时区，time_location:"Asia/Shanghai"指定时区，默认使用本地时区
+// 调用方式:Birthday time.Time `form:"birthday" time_format:"2006-01-02" time_location:"Asia/Shanghai"`
+func setTimeValue(value reflect.Value, field reflect.StructField, formValue string) error {
+	if formValue == "" {
+		value.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+	layout := field.Tag.Get("time_format")
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	switch layout {
+	case "unix", "unixnano":
+		n, err := strconv.ParseInt(formValue, 10, 64)
+		if err != nil {
+			return err
+		}
+		t := time.Unix(n, 0)
+		if layout == "unixnano" {
+			t = time.Unix(0, n)
+		}
+		value.Set(reflect.ValueOf(t))
+		return nil
+	}
+	location := time.Local
+	if isUTC, _ := strconv.ParseBool(field.Tag.Get("time_utc")); isUTC {
+		location = time.UTC
+	}
+	if locationName := field.Tag.Get("time_location"); locationName != "" {
+		loc, err := time.LoadLocation(locationName)
+		if err != nil {
+			return err
+		}
+		location = loc
+	}
+	t, err := time.ParseInLocation(layout, formValue, location)
+	if err != nil {
+		return err
+	}
+	value.Set(reflect.ValueOf(t))
+	return nil
+}
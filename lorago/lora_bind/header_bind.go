@@ -0,0 +1,37 @@
+package lora_bind
+
+import (
+	"errors"
+	"net/http"
+	"net/textproto"
+)
+
+/*
+*@Author: LorraineWen
+*定义请求头绑定器，通过header标签指定请求头名称，名称不区分大小写
+*调用方式:Token string `header:"X-Token"`
+ */
+type headerBinder struct{}
+
+func (headerBinder) Name() string {
+	return "header"
+}
+
+func (headerBinder) Bind(req *http.Request, obj any) error {
+	if req == nil {
+		return errors.New("请求错误")
+	}
+	if err := headerMapping(req, false).mapTo(obj); err != nil {
+		return err
+	}
+	return validateAllParams(obj)
+}
+
+func headerMapping(req *http.Request, requireTag bool) formMapping {
+	return formMapping{
+		values:     req.Header,
+		tags:       []string{"header"},
+		requireTag: requireTag,
+		keyFunc:    textproto.CanonicalMIMEHeaderKey,
+	}
+}
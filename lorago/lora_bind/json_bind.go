@@ -1,18 +1,27 @@
 package lora_bind
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 /*
 *@Author: LorraineWen
 *定义json格式绑定器
 *支持对结构体属性的校验和请求参数属性的校验
+*请求体直接解码到目标结构体，不再经过map中转，避免数字精度丢失
+*binding:"required"校验会递归检查嵌套的结构体，指针，切片和map，错误中包含完整的json路径，比如items[3].sku
+*required校验在encoding/json解码成功之后，通过json.RawMessage对同一份请求体再检查一遍属性是否出现
  */
 type jsonBinder struct {
 	DisallowUnknownFields bool
@@ -29,92 +38,275 @@ func (this jsonBinder) Bind(req *http.Request, data any) error {
 	}
 	return this.decodeJson(req.Body, data)
 }
-func (this jsonBinder) decodeJson(body io.ReadCloser, data any) error {
+func (this jsonBinder) decodeJson(body io.Reader, data any) error {
+	//如果启用了结构体属性检测，需要保留请求体，解码之后检查required属性是否出现
+	checkRequired := this.IsValidate && data != nil && hasRequired(reflect.TypeOf(data))
+	var raw []byte
+	if checkRequired {
+		var err error
+		if raw, err = io.ReadAll(body); err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
 	decoder := json.NewDecoder(body)
 	//如果启用了请求参数属性检测，那么就会检查请求参数中的属性，在相应结构体中是否存在
 	if this.DisallowUnknownFields {
 		decoder.DisallowUnknownFields()
 	}
-	//如果启用了请求参数属性检测，那么就会检查结构体中的属性，在相应请求参数中是否存在
-	//自定义校验方式
-	if this.IsValidate && !this.IsValidateAnother {
-		if data == nil {
-			return nil
-		}
-		valueOf := reflect.ValueOf(data)
-		//判断传入进来的是否是结构体指针，因为只有指针才传值
-		if valueOf.Kind() != reflect.Pointer {
-			return errors.New("bind data must be a pointer")
-		}
-		t := valueOf.Elem().Interface()
-		of := reflect.ValueOf(t)
-		switch of.Kind() {
-		//结构体类型的反射
-		case reflect.Struct:
-			return validateStructParams(of, data, decoder)
-		//切片类型的反射
-		case reflect.Slice, reflect.Array:
-			elem := of.Type().Elem()
-			elemType := elem.Kind()
-			if elemType == reflect.Struct {
-				return validateSliceParams(elem, data, decoder)
-			}
-		}
-	}
-	err := decoder.Decode(data)
-	if err != nil {
+	if err := decoder.Decode(data); err != nil {
 		return err
 	}
+	if checkRequired {
+		validateRet := make(ValidationErrors, 0)
+		//只检查解码使用的第一个json值
+		checkJsonRequired(raw[:decoder.InputOffset()], reflect.TypeOf(data), "", &validateRet)
+		if len(validateRet) > 0 {
+			return validateRet
+		}
+	}
 	//第三方，可以在结构体上面加上更多的标签，比如数值属性可以设置max和min作为取值范围
 	if this.IsValidateAnother {
-		err = validateAllParams(data)
-		if err != nil {
+		if err := validateAllParams(data); err != nil {
 			return err
 		}
 	}
 	return nil
 }
-func validateSliceParams(elem reflect.Type, data any, decoder *json.Decoder) error {
-	mapData := make([]map[string]interface{}, 0)
-	_ = decoder.Decode(&mapData)
-	if len(mapData) <= 0 {
-		return nil
-	}
-	for i := 0; i < elem.NumField(); i++ {
-		field := elem.Field(i)
-		tag := field.Tag.Get("json")
-		value := mapData[0][tag]
-		if value == nil && field.Tag.Get("binding") == "required" {
-			return errors.New(fmt.Sprintf("filed [%s] is required", tag))
-		}
-	}
-	if data != nil {
-		marshal, _ := json.Marshal(mapData)
-		err := json.Unmarshal(marshal, data)
-		if err != nil {
-			return err
+
+// 类型中是否存在需要检查的required属性，避免对没有required属性的部分进行扫描
+var requiredCache sync.Map //map[reflect.Type]bool
+
+func hasRequired(t reflect.Type) bool {
+	if cached, ok := requiredCache.Load(t); ok {
+		return cached.(bool)
+	}
+	ret := hasRequiredVisit(t, make(map[reflect.Type]bool))
+	requiredCache.Store(t, ret)
+	return ret
+}
+
+// visiting记录正在检查的类型，避免自引用的类型无限递归
+// 遇到循环引用时中间结果不完整，所以只缓存最外层类型的结果
+func hasRequiredVisit(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if cached, ok := requiredCache.Load(t); ok {
+		return cached.(bool)
+	}
+	if visiting[t] {
+		return false
+	}
+	visiting[t] = true
+	ret := false
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() && !field.Anonymous {
+				continue
+			}
+			if isRequired(field) || hasRequiredVisit(field.Type, visiting) {
+				ret = true
+				break
+			}
 		}
+	case reflect.Slice, reflect.Array, reflect.Map:
+		ret = hasRequiredVisit(t.Elem(), visiting)
 	}
-	return nil
+	delete(visiting, t)
+	return ret
 }
-func validateStructParams(of reflect.Value, data any, decoder *json.Decoder) error {
-	mapData := make(map[string]interface{})
-	err := decoder.Decode(&mapData)
-	if err != nil {
-		return err
+
+func isRequired(field reflect.StructField) bool {
+	for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+		if strings.TrimSpace(rule) == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonNull            = []byte("null")
+)
+
+// 不包含required属性或者自己实现了解码的类型，不需要检查
+func skipJsonRequired(t reflect.Type) bool {
+	if !hasRequired(t) {
+		return true
+	}
+	pt := reflect.PointerTo(t)
+	return t.Implements(jsonUnmarshalerType) || pt.Implements(jsonUnmarshalerType) ||
+		t.Implements(textUnmarshalerType) || pt.Implements(textUnmarshalerType)
+}
+
+// 按照类型检查data中的required属性是否出现，缺少的属性记录到validateRet中，null和不存在一样处理
+// data已经被encoding/json成功解码，结构和类型一致，这里只需要判断属性是否出现
+// 先检查内层的属性，再记录当前结构体缺少的属性，错误的顺序和解码时遇到的顺序一致
+func checkJsonRequired(data []byte, t reflect.Type, path string, validateRet *ValidationErrors) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if skipJsonRequired(t) || bytes.Equal(bytes.TrimSpace(data), jsonNull) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		object := make(map[string]json.RawMessage)
+		if json.Unmarshal(data, &object) != nil {
+			return
+		}
+		missing := make([]string, 0)
+		for _, field := range cachedJsonFields(t) {
+			fieldPath := joinJsonPath(path, field.name)
+			value, ok := lookupJsonValue(object, field.name)
+			if !ok {
+				if field.required {
+					missing = append(missing, fieldPath)
+				}
+				continue
+			}
+			//带有,string选项的属性是字符串中的基础类型，没有内层属性
+			if !field.quoted {
+				checkJsonRequired(value, field.typ, fieldPath, validateRet)
+			}
+		}
+		for _, fieldPath := range missing {
+			*validateRet = append(*validateRet, newFieldError(fieldPath, "required", ""))
+		}
+	case reflect.Slice, reflect.Array:
+		array := make([]json.RawMessage, 0)
+		if json.Unmarshal(data, &array) != nil {
+			return
+		}
+		for i, value := range array {
+			//和encoding/json一致，数组多出来的元素被丢弃
+			if t.Kind() == reflect.Array && i >= t.Len() {
+				break
+			}
+			checkJsonRequired(value, t.Elem(), path+"["+strconv.Itoa(i)+"]", validateRet)
+		}
+	case reflect.Map:
+		object := make(map[string]json.RawMessage)
+		if json.Unmarshal(data, &object) != nil {
+			return
+		}
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			checkJsonRequired(object[key], t.Elem(), joinJsonPath(path, key), validateRet)
+		}
 	}
-	for i := 0; i < of.NumField(); i++ {
-		field := of.Type().Field(i)
-		tag := field.Tag.Get("json") //获取结构体标签对应的值
-		value := mapData[tag]
-		if value == nil && field.Tag.Get("binding") == "required" { //如果该属性在请求中没有，并且是必须属性就报错
-			return errors.New(fmt.Sprintf("filed [%s] is not exist", tag))
+}
+
+// 和encoding/json一致，优先精确匹配，其次不区分大小写匹配，值为null时当作不存在
+func lookupJsonValue(object map[string]json.RawMessage, name string) (json.RawMessage, bool) {
+	value, ok := object[name]
+	if !ok {
+		for key, v := range object {
+			if strings.EqualFold(key, name) {
+				value, ok = v, true
+				break
+			}
 		}
 	}
-	marshal, err := json.Marshal(mapData)
-	if err != nil {
-		return err
+	if !ok || bytes.Equal(bytes.TrimSpace(value), jsonNull) {
+		return nil, false
+	}
+	return value, true
+}
+
+// 结构体中参与json解码的属性，匿名结构体的属性会被提升到当前层级
+type jsonField struct {
+	name     string
+	index    []int
+	typ      reflect.Type
+	required bool
+	quoted   bool //带有,string选项
+}
+
+var jsonFieldsCache sync.Map //map[reflect.Type][]jsonField
+
+func cachedJsonFields(t reflect.Type) []jsonField {
+	if cached, ok := jsonFieldsCache.Load(t); ok {
+		return cached.([]jsonField)
+	}
+	fields := make([]jsonField, 0, t.NumField())
+	collectJsonFields(t, nil, make(map[string]bool), &fields)
+	//按照属性定义的顺序排列，缺少required属性时错误的顺序和结构体一致
+	slices.SortFunc(fields, func(a, b jsonField) int {
+		return slices.Compare(a.index, b.index)
+	})
+	jsonFieldsCache.Store(t, fields)
+	return fields
+}
+
+// 先收集当前层级的属性，再收集匿名结构体的属性，同名时外层的属性优先
+func collectJsonFields(t reflect.Type, index []int, names map[string]bool, fields *[]jsonField) {
+	embedded := make([]reflect.StructField, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, skip := jsonFieldName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embeddedType := field.Type
+			for embeddedType.Kind() == reflect.Pointer {
+				embeddedType = embeddedType.Elem()
+			}
+			if embeddedType.Kind() == reflect.Struct {
+				embedded = append(embedded, field)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if names[name] {
+			continue
+		}
+		names[name] = true
+		*fields = append(*fields, jsonField{
+			name:     name,
+			index:    append(append([]int(nil), index...), i),
+			typ:      field.Type,
+			required: isRequired(field),
+			quoted:   options == "string",
+		})
+	}
+	for _, field := range embedded {
+		embeddedType := field.Type
+		for embeddedType.Kind() == reflect.Pointer {
+			embeddedType = embeddedType.Elem()
+		}
+		collectJsonFields(embeddedType, append(append([]int(nil), index...), field.Index[0]), names, fields)
+	}
+}
+
+// 获取属性对应的json名称和选项，skip为true表示该属性不参与json解码
+func jsonFieldName(field reflect.StructField) (name, options string, skip bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", "", true
+	}
+	name, options, _ = strings.Cut(tag, ",")
+	return name, options, false
+}
+
+func joinJsonPath(path, name string) string {
+	if path == "" {
+		return name
 	}
-	err = json.Unmarshal(marshal, data)
-	return err
+	return path + "." + name
 }
@@ -0,0 +1,146 @@
+package lora_bind
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+/*
+*@Author: LorraineWen
+*逐个解码json数组中的元素，整个数组不需要加载到内存中，适用于批量导入的接口
+*每个元素解码之后可以进行第三方校验，校验错误的属性路径带有元素下标，比如[3].sku
+ */
+type JsonArrayDecoder struct {
+	DisallowUnknownFields bool
+	Validate              bool //每个元素解码之后进行第三方校验
+	decoder               *json.Decoder
+	started               bool
+	finished              bool //已经读取了数组的结束符号
+	index                 int
+	err                   error //读取过程中遇到的第一个错误，不包括io.EOF
+}
+
+func NewJsonArrayDecoder(r io.Reader) *JsonArrayDecoder {
+	return &JsonArrayDecoder{decoder: json.NewDecoder(r)}
+}
+
+// 读取数组的开始符号[
+func (d *JsonArrayDecoder) start() error {
+	if d.started {
+		return d.err
+	}
+	d.started = true
+	if d.DisallowUnknownFields {
+		d.decoder.DisallowUnknownFields()
+	}
+	token, err := d.decoder.Token()
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			err = fmt.Errorf("json body must be an array, got %v", token)
+		}
+	}
+	d.setErr(err)
+	return err
+}
+
+func (d *JsonArrayDecoder) setErr(err error) {
+	if d.err == nil && err != nil && !errors.Is(err, io.EOF) {
+		d.err = err
+	}
+}
+
+// 返回读取过程中遇到的第一个错误，正常读取完整个数组时返回nil
+// More返回false之后需要调用Err判断是读取完了还是请求体不是json数组
+func (d *JsonArrayDecoder) Err() error {
+	return d.err
+}
+
+// 是否还有下一个元素，请求体不是json数组或者json格式错误时返回false，错误通过Err获取
+func (d *JsonArrayDecoder) More() bool {
+	if err := d.start(); err != nil {
+		return false
+	}
+	if d.decoder.More() {
+		return true
+	}
+	d.finish()
+	return false
+}
+
+// 读取数组的结束符号]，请求体在数组结束之前中断时记录错误
+func (d *JsonArrayDecoder) finish() error {
+	if d.finished || d.err != nil {
+		return d.err
+	}
+	d.finished = true
+	_, err := d.decoder.Token()
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	d.setErr(err)
+	return err
+}
+
+// 解码下一个元素，数组中没有元素之后返回io.EOF
+func (d *JsonArrayDecoder) Decode(v any) error {
+	if err := d.start(); err != nil {
+		return err
+	}
+	if d.finished || !d.decoder.More() {
+		if err := d.finish(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+	index := d.index
+	if err := d.decoder.Decode(v); err != nil {
+		err = fmt.Errorf("[%d]: %w", index, err)
+		d.setErr(err)
+		return err
+	}
+	d.index++
+	if d.Validate {
+		if err := validateAllParams(v); err != nil {
+			var validateRet ValidationErrors
+			if errors.As(err, &validateRet) {
+				return validateRet.withPrefix("[" + strconv.Itoa(index) + "]")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// 已经解码的元素数量
+func (d *JsonArrayDecoder) Count() int {
+	return d.index
+}
+
+// 逐个解码json数组中的元素，每解码一个元素就调用一次fn，fn返回错误时停止解码
+// 调用方式:
+//
+//	err := lora_bind.DecodeJsonArray(req.Body, func(user *User) error {
+//		return db.Save(user)
+//	})
+func DecodeJsonArray[T any](r io.Reader, fn func(item *T) error) error {
+	decoder := NewJsonArrayDecoder(r)
+	for {
+		item := new(T)
+		err := decoder.Decode(item)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(item); err != nil {
+			return err
+		}
+	}
+}
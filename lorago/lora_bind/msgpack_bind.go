@@ -0,0 +1,32 @@
+package lora_bind
+
+import (
+	"errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
+	"net/http"
+)
+
+/*
+*@Author: LorraineWen
+*定义msgpack格式绑定器，通过msgpack标签指定属性名称
+ */
+type msgpackBinder struct{}
+
+func (msgpackBinder) Name() string {
+	return "msgpack"
+}
+
+func (msgpackBinder) Bind(req *http.Request, obj any) error {
+	if req == nil || req.Body == nil {
+		return errors.New("请求错误")
+	}
+	return decodeMsgPack(req.Body, obj)
+}
+
+func decodeMsgPack(r io.Reader, obj any) error {
+	if err := msgpack.NewDecoder(r).Decode(obj); err != nil {
+		return err
+	}
+	return validateAllParams(obj)
+}
@@ -0,0 +1,40 @@
+package lora_bind
+
+import (
+	"errors"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+)
+
+/*
+*@Author: LorraineWen
+*定义protobuf格式绑定器，绑定的对象必须实现proto.Message
+ */
+type protobufBinder struct{}
+
+func (protobufBinder) Name() string {
+	return "protobuf"
+}
+
+func (protobufBinder) Bind(req *http.Request, obj any) error {
+	if req == nil || req.Body == nil {
+		return errors.New("请求错误")
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return err
+	}
+	return decodeProtoBuf(body, obj)
+}
+
+func decodeProtoBuf(body []byte, obj any) error {
+	message, ok := obj.(proto.Message)
+	if !ok {
+		return errors.New("bind data must implement proto.Message")
+	}
+	if err := proto.Unmarshal(body, message); err != nil {
+		return err
+	}
+	return validateAllParams(obj)
+}
@@ -0,0 +1,36 @@
+package lora_bind
+
+import (
+	"errors"
+	"net/http"
+)
+
+/*
+*@Author: LorraineWen
+*定义请求路径参数绑定器，/user?id=1&name=amie
+*通过query标签指定参数名称，没有query标签时使用form标签
+*IsValidate为true时检查binding:"required"的属性是否存在，和json绑定器一致
+ */
+type queryBinder struct {
+	IsValidate bool
+}
+
+func (queryBinder) Name() string {
+	return "query"
+}
+
+func (b queryBinder) Bind(req *http.Request, obj any) error {
+	if req == nil || req.URL == nil {
+		return errors.New("请求错误")
+	}
+	mapping := queryMapping(req, false)
+	mapping.validateRequired = b.IsValidate
+	if err := mapping.mapTo(obj); err != nil {
+		return err
+	}
+	return validateAllParams(obj)
+}
+
+func queryMapping(req *http.Request, requireTag bool) formMapping {
+	return formMapping{values: req.URL.Query(), tags: []string{"query", "form"}, requireTag: requireTag}
+}
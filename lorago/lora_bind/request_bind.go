@@ -0,0 +1,31 @@
+package lora_bind
+
+import "net/http"
+
+/*
+*@Author: LorraineWen
+*支持一个结构体同时绑定多个来源的参数，绑定完成之后统一进行第三方校验
+ */
+// 同时从路由参数，请求路径参数，请求头和cookie中绑定一个结构体，只绑定带有对应标签的属性
+// 调用方式:
+//
+//	type ListRequest struct {
+//		Id    int    `uri:"id"`
+//		Page  int    `query:"page" default:"1"`
+//		Token string `header:"X-Token"`
+//		Lang  string `cookie:"lang" default:"zh"`
+//	}
+func BindRequest(req *http.Request, params map[string][]string, obj any) error {
+	mappings := []formMapping{
+		uriMapping(params, true),
+		queryMapping(req, true),
+		headerMapping(req, true),
+		cookieMapping(req, true),
+	}
+	for _, mapping := range mappings {
+		if err := mapping.mapTo(obj); err != nil {
+			return err
+		}
+	}
+	return validateAllParams(obj)
+}
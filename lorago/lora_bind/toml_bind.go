@@ -0,0 +1,32 @@
+package lora_bind
+
+import (
+	"errors"
+	"github.com/BurntSushi/toml"
+	"io"
+	"net/http"
+)
+
+/*
+*@Author: LorraineWen
+*定义toml格式绑定器，通过toml标签指定属性名称
+ */
+type tomlBinder struct{}
+
+func (tomlBinder) Name() string {
+	return "toml"
+}
+
+func (tomlBinder) Bind(req *http.Request, obj any) error {
+	if req == nil || req.Body == nil {
+		return errors.New("请求错误")
+	}
+	return decodeToml(req.Body, obj)
+}
+
+func decodeToml(r io.Reader, obj any) error {
+	if _, err := toml.NewDecoder(r).Decode(obj); err != nil {
+		return err
+	}
+	return validateAllParams(obj)
+}
@@ -0,0 +1,82 @@
+package lora_bind
+
+import (
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator"
+)
+
+/*
+*@Author: LorraineWen
+*常用校验规则的错误信息，{0}表示属性名称，{1}表示规则参数
+*第三方校验库自带的翻译包依赖gopkg.in的另一个模块路径，无法直接使用，所以在这里维护
+ */
+var defaultTranslations = map[string]map[string]string{
+	"en": {
+		"required": "{0} is a required field",
+		"len":      "{0} must have a length of {1}",
+		"min":      "{0} must be at least {1}",
+		"max":      "{0} must be at most {1}",
+		"eq":       "{0} is not equal to {1}",
+		"ne":       "{0} should not be equal to {1}",
+		"gt":       "{0} must be greater than {1}",
+		"gte":      "{0} must be greater than or equal to {1}",
+		"lt":       "{0} must be less than {1}",
+		"lte":      "{0} must be less than or equal to {1}",
+		"oneof":    "{0} must be one of [{1}]",
+		"email":    "{0} must be a valid email address",
+		"url":      "{0} must be a valid URL",
+		"uuid":     "{0} must be a valid UUID",
+		"ip":       "{0} must be a valid IP address",
+		"numeric":  "{0} must be a valid numeric value",
+		"alpha":    "{0} can only contain alphabetic characters",
+		"alphanum": "{0} can only contain alphanumeric characters",
+		"eqfield":  "{0} must be equal to {1}",
+		"nefield":  "{0} cannot be equal to {1}",
+	},
+	"zh": {
+		"required": "{0}为必填字段",
+		"len":      "{0}长度必须是{1}",
+		"min":      "{0}最小只能为{1}",
+		"max":      "{0}最大只能为{1}",
+		"eq":       "{0}不等于{1}",
+		"ne":       "{0}不能等于{1}",
+		"gt":       "{0}必须大于{1}",
+		"gte":      "{0}必须大于或等于{1}",
+		"lt":       "{0}必须小于{1}",
+		"lte":      "{0}必须小于或等于{1}",
+		"oneof":    "{0}必须是[{1}]中的一个",
+		"email":    "{0}必须是一个有效的邮箱",
+		"url":      "{0}必须是一个有效的URL",
+		"uuid":     "{0}必须是一个有效的UUID",
+		"ip":       "{0}必须是一个有效的IP地址",
+		"numeric":  "{0}必须是一个有效的数值",
+		"alpha":    "{0}只能包含字母",
+		"alphanum": "{0}只能包含字母和数字",
+		"eqfield":  "{0}必须等于{1}",
+		"nefield":  "{0}不能等于{1}",
+	},
+}
+
+func registerDefaultTranslations(validate *validator.Validate, uni *ut.UniversalTranslator) {
+	for locale, messages := range defaultTranslations {
+		trans, found := uni.GetTranslator(locale)
+		if !found {
+			continue
+		}
+		for tag, message := range messages {
+			_ = registerTranslation(validate, trans, tag, message)
+		}
+	}
+}
+
+func registerTranslation(validate *validator.Validate, trans ut.Translator, tag, message string) error {
+	return validate.RegisterTranslation(tag, trans, func(trans ut.Translator) error {
+		return trans.Add(tag, message, true)
+	}, func(trans ut.Translator, fe validator.FieldError) string {
+		msg, err := trans.T(fe.Tag(), fe.Field(), fe.Param())
+		if err != nil {
+			return fe.(error).Error()
+		}
+		return msg
+	})
+}
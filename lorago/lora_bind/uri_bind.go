@@ -0,0 +1,23 @@
+package lora_bind
+
+/*
+*@Author: LorraineWen
+*定义路由参数绑定器，/user/get/:id中的id，通过uri标签指定参数名称
+*路由参数不在http.Request中，所以不实现Binder接口，由Context传入路由参数
+ */
+type uriBinder struct{}
+
+func (uriBinder) Name() string {
+	return "uri"
+}
+
+func (uriBinder) BindUri(params map[string][]string, obj any) error {
+	if err := uriMapping(params, false).mapTo(obj); err != nil {
+		return err
+	}
+	return validateAllParams(obj)
+}
+
+func uriMapping(params map[string][]string, requireTag bool) formMapping {
+	return formMapping{values: params, tags: []string{"uri"}, requireTag: requireTag}
+}
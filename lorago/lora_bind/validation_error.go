@@ -0,0 +1,83 @@
+package lora_bind
+
+import (
+	"github.com/go-playground/validator"
+	"net/http"
+	"strings"
+)
+
+/*
+*@Author: LorraineWen
+*结构化的校验错误，每个属性一条，可以直接作为json返回给客户端
+ */
+type FieldError struct {
+	Field   string `json:"field"`           //属性路径，比如items[3].sku
+	Rule    string `json:"rule"`            //校验失败的规则，比如required，max
+	Param   string `json:"param,omitempty"` //规则的参数，比如max=10中的10
+	Message string `json:"message"`         //国际化之后的错误信息
+	raw     validator.FieldError
+}
+
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, 0, len(v))
+	for _, fe := range v {
+		messages = append(messages, fe.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// 校验失败对应422状态码
+func (v ValidationErrors) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// 使用指定的语言重新生成错误信息，可以传入Accept-Language解析出来的多个语言
+// 调用方式:validationErrors.Localize("zh")
+func (v ValidationErrors) Localize(locales ...string) ValidationErrors {
+	trans := Validator.Translator(locales...)
+	ret := make(ValidationErrors, 0, len(v))
+	for _, fe := range v {
+		if fe.raw != nil {
+			fe.Message = fe.raw.Translate(trans)
+		} else {
+			fe.Message = Validator.message(fe.Rule, fieldName(fe.Field), fe.Param, locales...)
+		}
+		ret = append(ret, fe)
+	}
+	return ret
+}
+
+// 为所有属性路径加上前缀，用于切片元素和嵌套结构体
+func (v ValidationErrors) withPrefix(prefix string) ValidationErrors {
+	if prefix == "" {
+		return v
+	}
+	for i := range v {
+		if strings.HasPrefix(v[i].Field, "[") {
+			v[i].Field = prefix + v[i].Field
+		} else {
+			v[i].Field = prefix + "." + v[i].Field
+		}
+	}
+	return v
+}
+
+// 属性路径的最后一段，items[3].sku返回sku
+func fieldName(path string) string {
+	if index := strings.LastIndexByte(path, '.'); index >= 0 {
+		return path[index+1:]
+	}
+	return path
+}
+
+// 生成一条不经过第三方校验库的校验错误
+func newFieldError(path, rule, param string) FieldError {
+	return FieldError{
+		Field:   path,
+		Rule:    rule,
+		Param:   param,
+		Message: Validator.message(rule, fieldName(path), param),
+	}
+}
@@ -1,14 +1,24 @@
 package lora_bind
 
 import (
+	"errors"
 	"fmt"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator"
 	"reflect"
 	"strings"
 	"sync"
 )
 
-var Validator = &defaultValidator{}
+/*
+*@Author: LorraineWen
+*集成第三方的校验库，校验失败时返回ValidationErrors，包含属性路径，规则，参数和错误信息
+*错误信息通过universal-translator进行国际化，默认使用英文，支持en和zh
+*支持注册自定义的校验规则和对应的错误信息
+ */
+var Validator = &defaultValidator{locale: "en"}
 
 // 自定义一个验证器
 type LoraValidator interface {
@@ -22,6 +32,9 @@ type LoraValidator interface {
 type defaultValidator struct {
 	one      sync.Once
 	validate *validator.Validate
+	uni      *ut.UniversalTranslator
+	locale   string //默认的错误信息语言
+	lock     sync.RWMutex
 }
 
 // 集成一个第三方的post请求属性验证库
@@ -48,18 +61,95 @@ func (err SliceValidationError) Error() string {
 		return b.String()
 	}
 }
-func (d *defaultValidator) Engine(any) any {
+
+func (d *defaultValidator) lazyInit() {
 	d.one.Do(func() {
 		d.validate = validator.New()
+		//错误信息中的属性名称优先使用json标签，其次使用form标签
+		d.validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form", "query", "uri", "header", "xml"} {
+				name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return field.Name
+		})
+		enLocale := en.New()
+		d.uni = ut.New(enLocale, enLocale, zh.New())
+		registerDefaultTranslations(d.validate, d.uni)
 	})
+}
+
+func (d *defaultValidator) Engine() any {
+	d.lazyInit()
 	return d.validate
 }
+
+func (d *defaultValidator) ValidateStruct(obj any) error {
+	return d.validateAllParams(obj)
+}
+
+// 设置默认的错误信息语言，比如"zh"
+func (d *defaultValidator) SetLocale(locale string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.locale = locale
+}
+
+// 获取语言对应的翻译器，找不到时使用默认语言，可以传入Accept-Language解析出来的多个语言
+func (d *defaultValidator) Translator(locales ...string) ut.Translator {
+	d.lazyInit()
+	d.lock.RLock()
+	defaultLocale := d.locale
+	d.lock.RUnlock()
+	trans, found := d.uni.FindTranslator(append(locales, defaultLocale)...)
+	if !found {
+		return d.uni.GetFallback()
+	}
+	return trans
+}
+
+// 注册自定义的校验规则，messages是语言对应的错误信息，{0}表示属性名称，{1}表示规则参数
+// 调用方式:
+//
+//	lora_bind.Validator.RegisterValidation("mobile", func(fl validator.FieldLevel) bool {
+//		return len(fl.Field().String()) == 11
+//	}, map[string]string{"en": "{0} must be a mobile number", "zh": "{0}必须是手机号"})
+func (d *defaultValidator) RegisterValidation(tag string, fn validator.Func, messages map[string]string) error {
+	d.lazyInit()
+	if err := d.validate.RegisterValidation(tag, fn); err != nil {
+		return err
+	}
+	for locale, message := range messages {
+		trans, found := d.uni.GetTranslator(locale)
+		if !found {
+			return fmt.Errorf("unsupported locale [%s]", locale)
+		}
+		err := registerTranslation(d.validate, trans, tag, message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d *defaultValidator) validateStruct(obj any) error {
-	d.one.Do(func() {
-		d.validate = validator.New()
-	})
-	return validator.New().Struct(obj) //第三方的validate实例
+	d.lazyInit()
+	err := d.validate.Struct(obj) //第三方的validate实例
+	if err == nil {
+		return nil
+	}
+	var fieldErrors validator.ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		return d.convert(fieldErrors, "")
+	}
+	return err
 }
+
 func (d *defaultValidator) validateAllParams(data any) error {
 	if data == nil {
 		return nil
@@ -67,16 +157,25 @@ func (d *defaultValidator) validateAllParams(data any) error {
 	value := reflect.ValueOf(data)
 	switch value.Kind() {
 	case reflect.Ptr:
+		if value.IsNil() {
+			return nil
+		}
 		return d.validateAllParams(value.Elem().Interface())
 	case reflect.Struct:
 		return d.validateStruct(data)
 	case reflect.Slice, reflect.Array:
 		count := value.Len()
-		validateRet := make(SliceValidationError, 0)
+		validateRet := make(ValidationErrors, 0)
 		for i := 0; i < count; i++ {
-			if err := d.validateStruct(value.Index(i).Interface()); err != nil {
-				validateRet = append(validateRet, err)
+			err := d.validateAllParams(value.Index(i).Interface())
+			if err == nil {
+				continue
+			}
+			var fieldErrors ValidationErrors
+			if !errors.As(err, &fieldErrors) {
+				return err
 			}
+			validateRet = append(validateRet, fieldErrors.withPrefix(fmt.Sprintf("[%d]", i))...)
 		}
 		if len(validateRet) == 0 {
 			return nil
@@ -86,3 +185,34 @@ func (d *defaultValidator) validateAllParams(data any) error {
 		return nil
 	}
 }
+
+// 将第三方的校验错误转换为ValidationErrors
+func (d *defaultValidator) convert(fieldErrors validator.ValidationErrors, prefix string) ValidationErrors {
+	trans := d.Translator()
+	ret := make(ValidationErrors, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		//Namespace的第一段是结构体名称，需要去掉，User.address.city变成address.city
+		path := fe.Namespace()
+		if index := strings.IndexByte(path, '.'); index >= 0 {
+			path = path[index+1:]
+		}
+		ret = append(ret, FieldError{
+			Field:   path,
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fe.Translate(trans),
+			raw:     fe,
+		})
+	}
+	return ret.withPrefix(prefix)
+}
+
+// 生成规则对应的错误信息，用于不经过第三方校验库的校验，比如json绑定器的required校验
+func (d *defaultValidator) message(rule, field, param string, locales ...string) string {
+	trans := d.Translator(locales...)
+	msg, err := trans.T(rule, field, param)
+	if err != nil {
+		return fmt.Sprintf("field [%s] failed on the [%s] rule", field, rule)
+	}
+	return msg
+}
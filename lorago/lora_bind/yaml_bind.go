@@ -0,0 +1,32 @@
+package lora_bind
+
+import (
+	"errors"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+)
+
+/*
+*@Author: LorraineWen
+*定义yaml格式绑定器，通过yaml标签指定属性名称
+ */
+type yamlBinder struct{}
+
+func (yamlBinder) Name() string {
+	return "yaml"
+}
+
+func (yamlBinder) Bind(req *http.Request, obj any) error {
+	if req == nil || req.Body == nil {
+		return errors.New("请求错误")
+	}
+	return decodeYaml(req.Body, obj)
+}
+
+func decodeYaml(r io.Reader, obj any) error {
+	if err := yaml.NewDecoder(r).Decode(obj); err != nil {
+		return err
+	}
+	return validateAllParams(obj)
+}
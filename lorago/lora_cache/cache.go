@@ -0,0 +1,14 @@
+package lora_cache
+
+import "time"
+
+/*
+*@Author: LorraineWen
+*缓存接口，默认提供内存中的LRU实现，也可以实现该接口接入redis等外部缓存
+*值统一使用[]byte，方便外部缓存直接存储
+ */
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration) //ttl小于等于0表示不过期
+	Delete(key string)
+}
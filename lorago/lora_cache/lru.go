@@ -0,0 +1,92 @@
+package lora_cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*内存中的LRU缓存，超过容量时淘汰最久没有被访问的数据
+*过期的数据在被访问时删除
+ */
+type LRUCache struct {
+	capacity int
+	mu       sync.Mutex
+	ll       *list.List               //越靠前的数据越是最近访问过的
+	items    map[string]*list.Element //key对应链表中的节点
+}
+
+type entry struct {
+	key      string
+	value    []byte
+	expireAt time.Time //为零值表示不过期
+}
+
+func NewLRUCache(capacity int) *LRUCache {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &LRUCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := element.Value.(*entry)
+	if !e.expireAt.IsZero() && time.Now().After(e.expireAt) {
+		c.removeElement(element)
+		return nil, false
+	}
+	c.ll.MoveToFront(element)
+	return e.value, true
+}
+
+func (c *LRUCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var expireAt time.Time
+	if ttl > 0 {
+		expireAt = time.Now().Add(ttl)
+	}
+	if element, ok := c.items[key]; ok {
+		e := element.Value.(*entry)
+		e.value = value
+		e.expireAt = expireAt
+		c.ll.MoveToFront(element)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&entry{key: key, value: value, expireAt: expireAt})
+	for c.ll.Len() > c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+func (c *LRUCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.removeElement(element)
+	}
+}
+
+// 当前缓存的数据数量，包括已经过期但是还没有被删除的数据
+func (c *LRUCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+func (c *LRUCache) removeElement(element *list.Element) {
+	c.ll.Remove(element)
+	delete(c.items, element.Value.(*entry).key)
+}
@@ -5,4 +5,5 @@ type Conf struct {
 	Template map[string]any
 	Db       map[string]any
 	Pool     map[string]any
+	IpFilter map[string]any `toml:"ip_filter"`
 }
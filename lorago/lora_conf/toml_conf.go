@@ -5,21 +5,35 @@ import (
 	"github.com/BurntSushi/toml"
 	"github.com/LorraineWen/lorago/lora_log"
 	"os"
+	"sync"
 )
 
+// 调用Load之后才有配置文件中的值
 var TomlConf = &Conf{
 	Log:      make(map[string]any),
 	Template: make(map[string]any),
 	Db:       make(map[string]any),
 	Pool:     make(map[string]any),
+	IpFilter: make(map[string]any),
 }
 
-func init() {
-	loadToml()
+var (
+	confFile = flag.String("conf", "conf/cmd.toml", "app config file")
+	loadOnce sync.Once
+)
+
+// 第一次调用时读取配置文件，之后返回同一份配置
+// 程序还没有调用flag.Parse时在这里解析命令行，不在init中解析，避免其他包注册的命令行参数还没有注册
+// 调用方式:conf := lora_conf.Load()
+func Load() *Conf {
+	loadOnce.Do(loadToml)
+	return TomlConf
 }
+
 func loadToml() {
-	confFile := flag.String("conf", "conf/cmd.toml", "app config file")
-	flag.Parse()
+	if !flag.Parsed() {
+		flag.Parse()
+	}
 	if _, err := os.Stat(*confFile); err != nil {
 		lora_log.NewLogger().Info("conf/cmd.toml文件不存在")
 		return
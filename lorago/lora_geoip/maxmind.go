@@ -0,0 +1,56 @@
+package lora_geoip
+
+import (
+	"errors"
+	"github.com/oschwald/maxminddb-golang"
+	"net"
+)
+
+/*
+*@Author: LorraineWen
+*读取本地MaxMind格式(mmdb)的数据库文件，根据ip查询国家代码
+*支持GeoLite2-Country，GeoIP2-Country和GeoLite2-City等包含country字段的数据库
+ */
+var ErrNotFound = errors.New("ip not found in geoip database")
+
+type MaxMindDB struct {
+	reader *maxminddb.Reader
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	//没有country时使用注册地所在的国家
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// 调用方式:db, err := lora_geoip.Open("GeoLite2-Country.mmdb")
+func Open(path string) (*MaxMindDB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MaxMindDB{reader: reader}, nil
+}
+
+// 返回ISO 3166-1的两位国家代码，比如"CN"
+func (db *MaxMindDB) Country(ip net.IP) (string, error) {
+	var record countryRecord
+	if err := db.reader.Lookup(ip, &record); err != nil {
+		return "", err
+	}
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode, nil
+	}
+	if record.RegisteredCountry.ISOCode != "" {
+		return record.RegisteredCountry.ISOCode, nil
+	}
+	return "", ErrNotFound
+}
+
+func (db *MaxMindDB) Close() error {
+	return db.reader.Close()
+}
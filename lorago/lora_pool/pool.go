@@ -35,7 +35,7 @@ func NewPool(cap int) (*Pool, error) {
 
 // 通过配置文件加载go程池的属性
 func NewPoolConf() (*Pool, error) {
-	capacity, ok := lora_conf.TomlConf.Pool["cap"]
+	capacity, ok := lora_conf.Load().Pool["cap"]
 	if !ok {
 		panic("conf pool.cap not config")
 	}
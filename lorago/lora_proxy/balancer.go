@@ -0,0 +1,108 @@
+package lora_proxy
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*定义负载均衡器，支持轮询，最少连接和加权轮询
+*被动健康检查:上游连续失败MaxFails次之后，在FailTimeout时间内不再被选中
+ */
+type Upstream struct {
+	URL       *url.URL
+	Weight    int          //加权轮询时使用，小于等于0时按1处理
+	active    atomic.Int64 //正在处理的请求数量，最少连接时使用
+	fails     atomic.Int32 //连续失败次数
+	downUntil atomic.Int64 //在这个时间点(纳秒)之前，该上游被认为是不可用的
+}
+
+func NewUpstream(target string, weight int) (*Upstream, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	return &Upstream{URL: u, Weight: weight}, nil
+}
+
+// 当前正在处理的请求数量
+func (u *Upstream) Active() int64 {
+	return u.active.Load()
+}
+
+// 判断上游是否可用
+func (u *Upstream) Healthy() bool {
+	return time.Now().UnixNano() >= u.downUntil.Load()
+}
+
+func (u *Upstream) markFailure(maxFails int, failTimeout time.Duration) {
+	if int(u.fails.Add(1)) >= maxFails {
+		u.downUntil.Store(time.Now().Add(failTimeout).UnixNano())
+		u.fails.Store(0)
+	}
+}
+
+func (u *Upstream) markSuccess() {
+	u.fails.Store(0)
+}
+
+// 负载均衡器接口，从可用的上游中选出一个，upstreams一定不为空
+type Balancer interface {
+	Next(r *http.Request, upstreams []*Upstream) *Upstream
+}
+
+// 轮询
+type RoundRobin struct {
+	counter atomic.Uint64
+}
+
+func (b *RoundRobin) Next(_ *http.Request, upstreams []*Upstream) *Upstream {
+	n := b.counter.Add(1) - 1
+	return upstreams[n%uint64(len(upstreams))]
+}
+
+// 最少连接，选择正在处理请求最少的上游
+type LeastConn struct{}
+
+func (LeastConn) Next(_ *http.Request, upstreams []*Upstream) *Upstream {
+	best := upstreams[0]
+	for _, upstream := range upstreams[1:] {
+		if upstream.Active() < best.Active() {
+			best = upstream
+		}
+	}
+	return best
+}
+
+// 平滑加权轮询，和nginx的实现一致，权重高的上游被选中的次数多，并且不会被连续选中
+type Weighted struct {
+	mu      sync.Mutex
+	current map[*Upstream]int
+}
+
+func (b *Weighted) Next(_ *http.Request, upstreams []*Upstream) *Upstream {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.current == nil {
+		b.current = make(map[*Upstream]int)
+	}
+	total := 0
+	var best *Upstream
+	for _, upstream := range upstreams {
+		weight := upstream.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		total += weight
+		b.current[upstream] += weight
+		if best == nil || b.current[upstream] > b.current[best] {
+			best = upstream
+		}
+	}
+	b.current[best] -= total
+	return best
+}
@@ -0,0 +1,198 @@
+package lora_proxy
+
+import (
+	"context"
+	"errors"
+	"github.com/LorraineWen/lorago/lora_router"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*定义反向代理处理函数，可以注册到任意带有**的路由上，将请求转发给上游服务
+*支持多种负载均衡方式和被动健康检查
+*支持设置X-Forwarded-*请求头，自定义请求头，去掉路径前缀和超时
+*代理本身就是一个HandleFunc，所以可以和其他路由一样使用中间件
+ */
+const (
+	defaultMaxFails    = 1
+	defaultFailTimeout = 10 * time.Second
+)
+
+type Proxy struct {
+	Upstreams      []*Upstream
+	Balancer       Balancer          //为空时使用轮询
+	StripPrefix    string            //转发之前从请求路径中去掉的前缀，比如"/legacy"，按照路径段匹配，不会影响/legacyx
+	Timeout        time.Duration     //单次转发的超时时间，为0则不限制
+	MaxFails       int               //连续失败多少次之后标记为不可用，为0时使用1
+	FailTimeout    time.Duration     //标记为不可用的时间，为0时使用10秒
+	SetHeaders     map[string]string //转发之前设置的请求头
+	RemoveHeaders  []string          //转发之前删除的请求头
+	PreserveHost   bool              //是否保留客户端请求的Host，默认使用上游的Host
+	Transport      http.RoundTripper //为空时使用http.DefaultTransport
+	ModifyResponse func(*http.Response) error
+	proxies        map[*Upstream]*httputil.ReverseProxy
+	initOnce       sync.Once
+}
+
+// 根据上游地址创建代理，所有上游的权重都为1
+// 调用方式:
+//
+//	proxy, _ := lora_proxy.New("http://10.0.0.1:8080", "http://10.0.0.2:8080")
+//	proxy.StripPrefix = "/legacy"
+//	engine.Group("legacy").Any("/**", proxy.Handle, authMiddleware)
+func New(targets ...string) (*Proxy, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("proxy upstream is empty")
+	}
+	upstreams := make([]*Upstream, 0, len(targets))
+	for _, target := range targets {
+		upstream, err := NewUpstream(target, 1)
+		if err != nil {
+			return nil, err
+		}
+		upstreams = append(upstreams, upstream)
+	}
+	return &Proxy{Upstreams: upstreams}, nil
+}
+
+// 为每个上游创建httputil.ReverseProxy，没有调用时在第一次转发之前自动调用
+// 开始转发之后不能再修改配置，也不能再调用Init，需要修改配置时创建新的Proxy并重新注册路由
+func (p *Proxy) Init() {
+	if p.Balancer == nil {
+		p.Balancer = &RoundRobin{}
+	}
+	if p.MaxFails <= 0 {
+		p.MaxFails = defaultMaxFails
+	}
+	if p.FailTimeout <= 0 {
+		p.FailTimeout = defaultFailTimeout
+	}
+	p.proxies = make(map[*Upstream]*httputil.ReverseProxy, len(p.Upstreams))
+	for _, upstream := range p.Upstreams {
+		p.proxies[upstream] = p.newReverseProxy(upstream)
+	}
+}
+
+func (p *Proxy) newReverseProxy(upstream *Upstream) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(upstream.URL)
+			r.SetXForwarded()
+			if p.PreserveHost {
+				r.Out.Host = r.In.Host
+			}
+			for _, key := range p.RemoveHeaders {
+				r.Out.Header.Del(key)
+			}
+			for key, value := range p.SetHeaders {
+				r.Out.Header.Set(key, value)
+			}
+		},
+		Transport: p.Transport,
+		ModifyResponse: func(resp *http.Response) error {
+			//上游返回5xx也认为是一次失败
+			if resp.StatusCode >= http.StatusInternalServerError {
+				upstream.markFailure(p.MaxFails, p.FailTimeout)
+			} else {
+				upstream.markSuccess()
+			}
+			if p.ModifyResponse != nil {
+				return p.ModifyResponse(resp)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			//客户端断开连接时请求的context会被取消，这不是上游的问题，不计入失败次数
+			//Timeout超时的时候context的错误是DeadlineExceeded，仍然算作上游的失败
+			if !errors.Is(r.Context().Err(), context.Canceled) {
+				upstream.markFailure(p.MaxFails, p.FailTimeout)
+			}
+			status := http.StatusBadGateway
+			if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			w.WriteHeader(status)
+		},
+	}
+}
+
+// 选出一个可用的上游
+func (p *Proxy) next(r *http.Request) *Upstream {
+	healthy := make([]*Upstream, 0, len(p.Upstreams))
+	for _, upstream := range p.Upstreams {
+		if upstream.Healthy() {
+			healthy = append(healthy, upstream)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	return p.Balancer.Next(r, healthy)
+}
+
+// 代理的处理函数，直接作为路由的处理函数注册
+func (p *Proxy) Handle(ctx *lora_router.Context) {
+	p.initOnce.Do(func() {
+		if p.proxies == nil {
+			p.Init()
+		}
+	})
+	upstream := p.next(ctx.R)
+	if upstream == nil {
+		ctx.Fail(http.StatusServiceUnavailable, "no healthy upstream")
+		return
+	}
+	req := ctx.R
+	if p.StripPrefix != "" {
+		req = stripPrefix(req, p.StripPrefix)
+	}
+	if p.Timeout > 0 {
+		timeoutCtx, cancel := context.WithTimeout(req.Context(), p.Timeout)
+		defer cancel()
+		req = req.WithContext(timeoutCtx)
+	}
+	upstream.active.Add(1)
+	defer upstream.active.Add(-1)
+	w := lora_router.NewStatusWriter(ctx.W)
+	p.proxies[upstream].ServeHTTP(w, req)
+	ctx.StatusCode = w.Status
+}
+
+// 复制一个去掉了路径前缀的请求，不修改原请求
+// 前缀只匹配完整的路径段，/api可以去掉/api和/api/x的前缀，但是不会把/apiary/x变成ry/x
+func stripPrefix(r *http.Request, prefix string) *http.Request {
+	prefix = "/" + strings.Trim(prefix, "/")
+	path, ok := trimPathPrefix(r.URL.Path, prefix)
+	if !ok {
+		return r
+	}
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = path
+	//RawPath和Path不一致时交给url包重新生成
+	r2.URL.RawPath = ""
+	if r.URL.RawPath != "" {
+		if rawPath, ok := trimPathPrefix(r.URL.RawPath, prefix); ok {
+			r2.URL.RawPath = rawPath
+		}
+	}
+	return r2
+}
+
+// 去掉完整路径段的前缀，返回的路径一定以/开头
+func trimPathPrefix(path, prefix string) (string, bool) {
+	if prefix == "/" {
+		return path, true
+	}
+	if path == prefix {
+		return "/", true
+	}
+	if strings.HasPrefix(path, prefix+"/") {
+		return path[len(prefix):], true
+	}
+	return path, false
+}
@@ -1,13 +1,32 @@
 package lora_render
 
 import (
+	"errors"
 	"html/template"
 	"net/http"
 )
 
-// 用于html模板加载到内存中时，对加载的模板进行存储
+// 用于html模板加载到内存中时，对加载的模板进行存储，是默认的HTMLRenderer
 type HtmlTemplateRender struct {
 	Template *template.Template
+	Set      *TemplateSet      //通过LoadTemplates加载的多页面模板，不为空时优先使用
+	contexts *contextTemplates //带有请求上下文的模板副本池
+}
+
+// 调用方式:engine.SetHTMLRenderer(lora_render.NewHtmlTemplateRender(t))
+func NewHtmlTemplateRender(t *template.Template) *HtmlTemplateRender {
+	//html/template执行过之后就不能再Clone，所以在执行之前保留一份副本
+	return &HtmlTemplateRender{Template: t, contexts: newContextTemplates(template.Must(t.Clone()))}
+}
+
+func (h *HtmlTemplateRender) Instance(name string, data any, rc *RenderContext) Render {
+	switch {
+	case h.Set != nil:
+		return h.Set.Instance(name, data, rc)
+	case h.Template == nil:
+		return errorRender{err: errors.New("html template is not loaded")}
+	}
+	return contextRender(h.Template, h.contexts, name, data, rc)
 }
 
 var htmlContentType string = "text/html; charset=utf-8"
@@ -17,6 +36,7 @@ type HtmlRender struct {
 	Template   *template.Template
 	Name       string
 	IsTemplate bool
+	bound      *contextTemplate //从副本池中取出的模板，渲染完成之后放回
 }
 
 func (h *HtmlRender) Render(w http.ResponseWriter, status int) error {
@@ -26,6 +46,9 @@ func (h *HtmlRender) Render(w http.ResponseWriter, status int) error {
 		_, err := w.Write([]byte(h.Data.(string)))
 		return err
 	}
+	if h.bound != nil {
+		defer h.bound.release()
+	}
 	err := h.Template.ExecuteTemplate(w, h.Name, h.Data)
 	return err
 }
@@ -0,0 +1,170 @@
+package lora_render
+
+import (
+	"html/template"
+	"net/http"
+	"sync"
+	texttemplate "text/template"
+)
+
+/*
+*@Author: LorraineWen
+*TemplateResponseWrite通过HTMLRenderer创建Render，可以替换为其他的模板引擎
+*默认使用html/template，也提供了text/template的实现，可以用于渲染邮件等内容
+*RenderContext携带每个请求自己的数据，比如csrf token和当前登录的用户
+*模板中通过{{ctx "key"}}获取RenderContext中的值，通过{{csrfField}}输出csrf token的隐藏表单字段
+ */
+type HTMLRenderer interface {
+	Instance(name string, data any, rc *RenderContext) Render
+}
+
+// 每个请求的模板上下文
+type RenderContext struct {
+	Request *http.Request
+	Values  map[string]any
+}
+
+func (rc *RenderContext) Get(key string) any {
+	if rc == nil {
+		return nil
+	}
+	return rc.Values[key]
+}
+
+func (rc *RenderContext) hasValues() bool {
+	return rc != nil && len(rc.Values) > 0
+}
+
+// 模板中获取请求上下文的函数，解析模板之前需要先注册，否则模板中使用ctx会解析失败
+// 调用方式:template.New("").Funcs(lora_render.ContextFuncMap(nil)).ParseGlob(pattern)
+func ContextFuncMap(rc *RenderContext) template.FuncMap {
+	return contextFuncMap(func() *RenderContext { return rc })
+}
+
+// current在模板执行时返回当前请求的上下文
+func contextFuncMap(current func() *RenderContext) template.FuncMap {
+	return template.FuncMap{
+		"ctx":       func(key string) any { return current().Get(key) },
+		"csrfToken": func() string { return current().csrfToken() },
+		"csrfField": func() template.HTML { return current().csrfField() },
+	}
+}
+
+// csrf中间件写入RenderContext的key
+const (
+	CSRFTokenKey     = "csrf_token"
+	CSRFFieldNameKey = "csrf_field_name"
+)
+
+func (rc *RenderContext) csrfToken() string {
+	token, _ := rc.Get(CSRFTokenKey).(string)
+	return token
+}
+
+// 生成包含csrf token的隐藏表单字段，在表单中使用{{csrfField}}
+func (rc *RenderContext) csrfField() template.HTML {
+	token := rc.csrfToken()
+	if token == "" {
+		return ""
+	}
+	name, _ := rc.Get(CSRFFieldNameKey).(string)
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(name) + `" value="` + template.HTMLEscapeString(token) + `">`)
+}
+
+// 带有请求上下文的模板副本池，副本中的ctx等函数读取副本当前绑定的RenderContext
+// html/template复制之后第一次执行时需要重新转义，副本执行完之后放回池中复用，不需要每次渲染都复制和转义
+type contextTemplates struct {
+	pristine *template.Template //没有执行过的模板，执行过的模板不能再Clone
+	pool     sync.Pool
+}
+
+func newContextTemplates(pristine *template.Template) *contextTemplates {
+	return &contextTemplates{pristine: pristine}
+}
+
+// 同一时间只会被一个请求使用的模板副本
+type contextTemplate struct {
+	template *template.Template
+	rc       *RenderContext
+	owner    *contextTemplates
+}
+
+// 从池中取出一个副本并绑定请求上下文，渲染完成之后需要调用release
+func (c *contextTemplates) get(rc *RenderContext) (*contextTemplate, error) {
+	if bound, ok := c.pool.Get().(*contextTemplate); ok {
+		bound.rc = rc
+		return bound, nil
+	}
+	clone, err := c.pristine.Clone()
+	if err != nil {
+		return nil, err
+	}
+	bound := &contextTemplate{rc: rc, owner: c}
+	bound.template = clone.Funcs(contextFuncMap(func() *RenderContext { return bound.rc }))
+	return bound, nil
+}
+
+func (b *contextTemplate) release() {
+	b.rc = nil
+	b.owner.pool.Put(b)
+}
+
+// 请求上下文有值时从副本池中取出模板，否则直接使用共享的模板
+func contextRender(t *template.Template, contexts *contextTemplates, name string, data any, rc *RenderContext) Render {
+	if !rc.hasValues() || contexts == nil {
+		return &HtmlRender{IsTemplate: true, Name: name, Data: data, Template: t}
+	}
+	bound, err := contexts.get(rc)
+	if err != nil {
+		return errorRender{err: err}
+	}
+	return &HtmlRender{IsTemplate: true, Name: name, Data: data, Template: bound.template, bound: bound}
+}
+
+// 创建Render失败时使用，渲染时返回错误，最终由engine的errHandler返回500
+type errorRender struct {
+	err error
+}
+
+func (e errorRender) Render(w http.ResponseWriter, status int) error {
+	return e.err
+}
+
+// 基于text/template的HTMLRenderer，text/template不会转义html，只能用于可信的数据
+// 调用方式:
+//
+//	t := texttemplate.Must(texttemplate.New("").Funcs(texttemplate.FuncMap(lora_render.ContextFuncMap(nil))).ParseGlob("mail/*.tmpl"))
+//	engine.SetHTMLRenderer(&lora_render.TextTemplateRender{Template: t, ContentType: "text/plain; charset=utf-8"})
+type TextTemplateRender struct {
+	Template    *texttemplate.Template
+	ContentType string //为空时使用text/html; charset=utf-8
+}
+
+func (t *TextTemplateRender) Instance(name string, data any, rc *RenderContext) Render {
+	tmpl := t.Template
+	if rc.hasValues() {
+		clone, err := tmpl.Clone()
+		if err != nil {
+			return errorRender{err: err}
+		}
+		tmpl = clone.Funcs(texttemplate.FuncMap(ContextFuncMap(rc)))
+	}
+	return &TextRender{Template: tmpl, Name: name, Data: data, ContentType: t.ContentType}
+}
+
+type TextRender struct {
+	Template    *texttemplate.Template
+	Name        string
+	Data        any
+	ContentType string
+}
+
+func (t *TextRender) Render(w http.ResponseWriter, status int) error {
+	contentType := t.ContentType
+	if contentType == "" {
+		contentType = htmlContentType
+	}
+	writeContentType(w, contentType)
+	w.WriteHeader(status)
+	return t.Template.ExecuteTemplate(w, t.Name, t.Data)
+}
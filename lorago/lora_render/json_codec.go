@@ -0,0 +1,34 @@
+package lora_render
+
+import (
+	"encoding/json"
+	"io"
+)
+
+/*
+*@Author: LorraineWen
+*json编码器接口，默认使用encoding/json，可以替换为更快的第三方json库
+*调用方式:lora_render.JsonCodec = myCodec{}
+ */
+type JsonEncoder interface {
+	Encode(v any) error
+	SetEscapeHTML(on bool)
+	SetIndent(prefix, indent string)
+}
+
+type JsonCodecInterface interface {
+	Marshal(v any) ([]byte, error)
+	NewEncoder(w io.Writer) JsonEncoder
+}
+
+var JsonCodec JsonCodecInterface = stdJsonCodec{}
+
+type stdJsonCodec struct{}
+
+func (stdJsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdJsonCodec) NewEncoder(w io.Writer) JsonEncoder {
+	return json.NewEncoder(w)
+}
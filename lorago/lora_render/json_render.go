@@ -1,23 +1,156 @@
 package lora_render
 
 import (
-	"encoding/json"
+	"bytes"
+	"fmt"
 	"net/http"
+	"regexp"
+	"unicode/utf8"
 )
 
+/*
+*@Author: LorraineWen
+*支持多种json响应格式:普通json，缩进json，安全json，jsonp，ascii json和不转义html的json
+*普通json和缩进json边编码边写入传入的http.ResponseWriter，不会先编码到临时的[]byte中
+*通过Context渲染时，超过缓冲区大小的响应会直接写给客户端，见engine.SetRenderBufferSize
+ */
 type JsonRender struct {
 	Data any
 }
 
 var jsonContentType string = "application/json; charset=utf-8"
+var jsonpContentType string = "application/javascript; charset=utf-8"
+var jsonASCIIContentType string = "application/json"
 
 func (j *JsonRender) Render(w http.ResponseWriter, status int) error {
 	writeContentType(w, jsonContentType)
 	w.WriteHeader(status)
-	dataJson, err := json.Marshal(j.Data)
+	return JsonCodec.NewEncoder(w).Encode(j.Data)
+}
+
+// 缩进的json，方便调试的时候查看
+type IndentedJsonRender struct {
+	Data any
+}
+
+func (j *IndentedJsonRender) Render(w http.ResponseWriter, status int) error {
+	writeContentType(w, jsonContentType)
+	w.WriteHeader(status)
+	encoder := JsonCodec.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(j.Data)
+}
+
+// 默认的安全json前缀
+const DefaultSecureJsonPrefix = "while(1);"
+
+// 安全json，如果数据是数组，会在前面加上前缀，防止json劫持
+type SecureJsonRender struct {
+	Prefix string //为空时使用while(1);
+	Data   any
+}
+
+func (j *SecureJsonRender) Render(w http.ResponseWriter, status int) error {
+	writeContentType(w, jsonContentType)
+	data, err := JsonCodec.Marshal(j.Data)
 	if err != nil {
 		return err
 	}
-	_, err = w.Write(dataJson)
+	w.WriteHeader(status)
+	if bytes.HasPrefix(data, []byte("[")) && bytes.HasSuffix(data, []byte("]")) {
+		prefix := j.Prefix
+		if prefix == "" {
+			prefix = DefaultSecureJsonPrefix
+		}
+		if _, err = w.Write([]byte(prefix)); err != nil {
+			return err
+		}
+	}
+	_, err = w.Write(data)
 	return err
 }
+
+// jsonp的回调函数名称只允许是合法的javascript标识符，避免xss
+var jsonpCallbackPattern = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$.]*$`)
+
+func IsValidJsonpCallback(callback string) bool {
+	return jsonpCallbackPattern.MatchString(callback)
+}
+
+// jsonp，返回callback(data);，Callback为空时和普通json一致
+type JsonpRender struct {
+	Callback string
+	Data     any
+}
+
+func (j *JsonpRender) Render(w http.ResponseWriter, status int) error {
+	if j.Callback == "" {
+		return (&JsonRender{Data: j.Data}).Render(w, status)
+	}
+	if !IsValidJsonpCallback(j.Callback) {
+		return fmt.Errorf("invalid jsonp callback [%s]", j.Callback)
+	}
+	writeContentType(w, jsonpContentType)
+	data, err := JsonCodec.Marshal(j.Data)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(status)
+	//前面加上/**/可以防止rosetta flash攻击
+	if _, err = w.Write([]byte("/**/" + j.Callback + "(")); err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(");"))
+	return err
+}
+
+// 将非ascii字符转义为\uXXXX的json
+type AsciiJsonRender struct {
+	Data any
+}
+
+func (j *AsciiJsonRender) Render(w http.ResponseWriter, status int) error {
+	writeContentType(w, jsonASCIIContentType)
+	data, err := JsonCodec.Marshal(j.Data)
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(status)
+	_, err = w.Write(toASCII(data))
+	return err
+}
+
+func toASCII(data []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(data))
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r < utf8.RuneSelf {
+			buf.WriteByte(data[0])
+		} else if r > 0xFFFF {
+			//超出基本平面的字符需要使用代理对表示
+			r -= 0x10000
+			fmt.Fprintf(&buf, `\u%04x\u%04x`, 0xD800+(r>>10), 0xDC00+(r&0x3FF))
+		} else {
+			fmt.Fprintf(&buf, `\u%04x`, r)
+		}
+		data = data[size:]
+	}
+	return buf.Bytes()
+}
+
+// 不转义<，>和&的json，默认的json会把它们转义为\u003c等
+type PureJsonRender struct {
+	Data any
+}
+
+func (j *PureJsonRender) Render(w http.ResponseWriter, status int) error {
+	writeContentType(w, jsonContentType)
+	w.WriteHeader(status)
+	encoder := JsonCodec.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(j.Data)
+}
@@ -0,0 +1,23 @@
+package lora_render
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+	"net/http"
+)
+
+type MsgPackRender struct {
+	Data any
+}
+
+var msgpackContentType = "application/msgpack"
+
+func (m *MsgPackRender) Render(w http.ResponseWriter, status int) error {
+	data, err := msgpack.Marshal(m.Data)
+	if err != nil {
+		return err
+	}
+	writeContentType(w, msgpackContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,161 @@
+package lora_render
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+*@Author: LorraineWen
+*支持根据Accept请求头进行内容协商，解析q值，选择最合适的响应格式
+*媒体类型和Render的对应关系可以通过RegisterRender扩展
+ */
+// 媒体类型常量，lora_bind选择绑定器时也使用这里的定义
+const (
+	MIMEJSON              = "application/json"
+	MIMEXML               = "application/xml"
+	MIMEXML2              = "text/xml"
+	MIMEHTML              = "text/html"
+	MIMEPlain             = "text/plain"
+	MIMEPOSTForm          = "application/x-www-form-urlencoded"
+	MIMEMultipartPOSTForm = "multipart/form-data"
+	MIMEYAML              = "application/yaml"
+	MIMEYAML2             = "application/x-yaml"
+	MIMEYAML3             = "text/yaml"
+	MIMETOML              = "application/toml"
+	MIMEMSGPACK           = "application/msgpack"
+	MIMEMSGPACK2          = "application/x-msgpack"
+	MIMEMSGPACK3          = "application/vnd.msgpack"
+	MIMEPROTOBUF          = "application/x-protobuf"
+	MIMEPROTOBUF2         = "application/protobuf"
+)
+
+// 客户端接受的格式都不支持时返回的错误，对应406状态码
+var ErrNotAcceptable = errors.New("not acceptable")
+
+type RenderFactory func(data any) Render
+
+var renders = map[string]RenderFactory{
+	MIMEJSON:      func(data any) Render { return &JsonRender{Data: data} },
+	MIMEXML:       func(data any) Render { return &XmlRender{Data: data} },
+	MIMEXML2:      func(data any) Render { return &XmlRender{Data: data} },
+	MIMEYAML:      func(data any) Render { return &YamlRender{Data: data} },
+	MIMEYAML2:     func(data any) Render { return &YamlRender{Data: data} },
+	MIMEYAML3:     func(data any) Render { return &YamlRender{Data: data} },
+	MIMETOML:      func(data any) Render { return &TomlRender{Data: data} },
+	MIMEMSGPACK:   func(data any) Render { return &MsgPackRender{Data: data} },
+	MIMEMSGPACK2:  func(data any) Render { return &MsgPackRender{Data: data} },
+	MIMEMSGPACK3:  func(data any) Render { return &MsgPackRender{Data: data} },
+	MIMEPROTOBUF:  func(data any) Render { return &ProtoBufRender{Data: data} },
+	MIMEPROTOBUF2: func(data any) Render { return &ProtoBufRender{Data: data} },
+	MIMEPlain:     func(data any) Render { return &StringRender{Format: "%v", Data: []any{data}} },
+}
+var rendersLock sync.RWMutex
+
+// 注册媒体类型对应的Render，已经存在的会被覆盖
+// 调用方式:lora_render.RegisterRender("application/vnd.api+json", func(data any) lora_render.Render {...})
+func RegisterRender(mediaType string, factory RenderFactory) {
+	rendersLock.Lock()
+	defer rendersLock.Unlock()
+	renders[strings.ToLower(mediaType)] = factory
+}
+
+// 根据媒体类型创建Render
+func NewRender(mediaType string, data any) (Render, bool) {
+	rendersLock.RLock()
+	defer rendersLock.RUnlock()
+	factory, ok := renders[strings.ToLower(mediaType)]
+	if !ok {
+		return nil, false
+	}
+	return factory(data), true
+}
+
+// Accept中的一项，比如text/html;q=0.8
+type acceptRange struct {
+	mainType string
+	subType  string
+	q        float64
+}
+
+// 解析Accept请求头，按照q值从大到小排序
+func parseAccept(accept string) []acceptRange {
+	ranges := make([]acceptRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+		mainType, subType, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			//兼容只写了*的客户端
+			if mediaType != "*" {
+				continue
+			}
+			mainType, subType = "*", "*"
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(strings.TrimSpace(key)) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		ranges = append(ranges, acceptRange{mainType: mainType, subType: subType, q: q})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+	return ranges
+}
+
+// 匹配的精确程度，越大越精确，-1表示不匹配
+func (a acceptRange) match(mediaType string) int {
+	mainType, subType, _ := strings.Cut(strings.ToLower(mediaType), "/")
+	switch {
+	case a.mainType == mainType && a.subType == subType:
+		return 2
+	case a.mainType == mainType && a.subType == "*":
+		return 1
+	case a.mainType == "*" && a.subType == "*":
+		return 0
+	default:
+		return -1
+	}
+}
+
+// 从offered中选出Accept最偏好的媒体类型，q值相同时优先选择offered中靠前的
+// Accept为空时返回offered中的第一个，都不匹配时返回空字符串
+func NegotiateContentType(accept string, offered []string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offered[0]
+	}
+	ranges := parseAccept(accept)
+	best := ""
+	bestQ := 0.0
+	for _, mediaType := range offered {
+		//每个媒体类型使用最精确匹配的那一项的q值
+		q := 0.0
+		precision := -1
+		for _, r := range ranges {
+			if p := r.match(mediaType); p > precision {
+				precision = p
+				q = r.q
+			}
+		}
+		if precision >= 0 && q > bestQ {
+			best = mediaType
+			bestQ = q
+		}
+	}
+	return best
+}
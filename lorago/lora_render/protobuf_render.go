@@ -0,0 +1,28 @@
+package lora_render
+
+import (
+	"errors"
+	"google.golang.org/protobuf/proto"
+	"net/http"
+)
+
+type ProtoBufRender struct {
+	Data any //必须实现proto.Message
+}
+
+var protobufContentType = "application/x-protobuf"
+
+func (p *ProtoBufRender) Render(w http.ResponseWriter, status int) error {
+	message, ok := p.Data.(proto.Message)
+	if !ok {
+		return errors.New("protobuf render data must implement proto.Message")
+	}
+	data, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	writeContentType(w, protobufContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,91 @@
+package lora_render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+/*
+*@Author: LorraineWen
+*支持Server-Sent Events格式的响应
+*一个事件可以携带id，事件类型，重连时间和数据，数据如果不是字符串会被编码成json
+ */
+type SSEvent struct {
+	Id    string
+	Event string
+	Retry uint //客户端断开之后的重连间隔，单位毫秒，为0则不发送
+	Data  any
+}
+
+var sseContentType = "text/event-stream"
+
+// 设置事件流需要的响应头，只需要在第一个事件之前调用一次
+func WriteSSEHeader(w http.ResponseWriter) {
+	header := w.Header()
+	writeContentType(w, sseContentType)
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") //避免nginx缓存事件流
+}
+
+func (s *SSEvent) Render(w http.ResponseWriter, status int) error {
+	WriteSSEHeader(w)
+	w.WriteHeader(status)
+	return s.Encode(w)
+}
+
+// 按照event-stream的格式将事件写入w，一个事件以空行结束
+func (s *SSEvent) Encode(w io.Writer) error {
+	var sb strings.Builder
+	if s.Id != "" {
+		sb.WriteString("id: " + escapeSSELine(s.Id) + "\n")
+	}
+	if s.Event != "" {
+		sb.WriteString("event: " + escapeSSELine(s.Event) + "\n")
+	}
+	if s.Retry > 0 {
+		sb.WriteString(fmt.Sprintf("retry: %d\n", s.Retry))
+	}
+	data, err := sseData(s.Data)
+	if err != nil {
+		return err
+	}
+	//多行数据需要每一行都以data:开头
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: " + strings.TrimSuffix(line, "\r") + "\n")
+	}
+	sb.WriteString("\n")
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+// 写入一条注释，客户端会忽略它，通常用作心跳，防止代理断开空闲连接
+func WriteSSEComment(w io.Writer, comment string) error {
+	_, err := io.WriteString(w, ": "+escapeSSELine(comment)+"\n\n")
+	return err
+}
+
+func sseData(data any) (string, error) {
+	switch v := data.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	default:
+		dataJson, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(dataJson), nil
+	}
+}
+
+// id和event字段不允许换行，否则会被客户端解析成别的字段
+func escapeSSELine(s string) string {
+	return strings.NewReplacer("\n", "", "\r", "").Replace(s)
+}
@@ -0,0 +1,238 @@
+package lora_render
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*管理多个html模板，支持从多个目录和embed.FS中加载模板
+*布局模板(layouts)会被每个页面模板共享，页面模板通过{{define}}覆盖布局中的{{block}}实现继承
+*每个页面模板单独解析一份，不同页面定义同名的block不会互相覆盖
+*支持为单个页面模板设置专用的函数，开发模式下模板文件发生变化时会自动重新解析
+ */
+type TemplateSource struct {
+	FS      fs.FS    //为空时从本地文件系统加载，可以是embed.FS
+	Layouts []string //布局和公共模板的glob，比如"layouts/*.html"
+	Pages   []string //页面模板的glob，比如"pages/*.html"，页面名称是文件名
+}
+
+type TemplateOptions struct {
+	Sources []TemplateSource
+	FuncMap template.FuncMap            //所有模板共享的函数
+	Funcs   map[string]template.FuncMap //页面名称对应的专用函数
+	Dev     bool                        //开发模式，渲染之前检查模板文件是否变化，变化时重新解析
+}
+
+// 调用方式:
+//
+//	//go:embed templates
+//	var templateFS embed.FS
+//	set, err := lora_render.NewTemplateSet(lora_render.TemplateOptions{Sources: []lora_render.TemplateSource{
+//		{FS: templateFS, Layouts: []string{"templates/layouts/*.html"}, Pages: []string{"templates/pages/*.html"}},
+//		{Pages: []string{"../test/template/*.html"}},
+//	}})
+type TemplateSet struct {
+	options   TemplateOptions
+	pages     map[string]*template.Template
+	contexts  map[string]*contextTemplates //页面模板对应的带有请求上下文的副本池
+	signature string                       //所有模板文件的名称和修改时间，用于开发模式判断是否需要重新解析
+	lock      sync.RWMutex
+}
+
+func NewTemplateSet(options TemplateOptions) (*TemplateSet, error) {
+	t := &TemplateSet{options: options}
+	if err := t.Load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// 一个模板文件，fsys为空表示本地文件系统
+type templateFile struct {
+	fsys fs.FS
+	path string
+}
+
+func (f templateFile) name() string {
+	if f.fsys == nil {
+		return filepath.Base(f.path)
+	}
+	return path.Base(f.path)
+}
+
+func (f templateFile) read() ([]byte, error) {
+	if f.fsys == nil {
+		return os.ReadFile(f.path)
+	}
+	return fs.ReadFile(f.fsys, f.path)
+}
+
+func (f templateFile) modTime() time.Time {
+	var info fs.FileInfo
+	var err error
+	if f.fsys == nil {
+		info, err = os.Stat(f.path)
+	} else {
+		info, err = fs.Stat(f.fsys, f.path)
+	}
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func globFiles(fsys fs.FS, patterns []string) ([]templateFile, error) {
+	files := make([]templateFile, 0)
+	for _, pattern := range patterns {
+		var matches []string
+		var err error
+		if fsys == nil {
+			matches, err = filepath.Glob(pattern)
+		} else {
+			matches, err = fs.Glob(fsys, pattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			files = append(files, templateFile{fsys: fsys, path: match})
+		}
+	}
+	return files, nil
+}
+
+// 找到所有的布局模板和页面模板
+func (t *TemplateSet) files() (layouts, pages []templateFile, err error) {
+	for _, source := range t.options.Sources {
+		sourceLayouts, err := globFiles(source.FS, source.Layouts)
+		if err != nil {
+			return nil, nil, err
+		}
+		sourcePages, err := globFiles(source.FS, source.Pages)
+		if err != nil {
+			return nil, nil, err
+		}
+		layouts = append(layouts, sourceLayouts...)
+		pages = append(pages, sourcePages...)
+	}
+	return layouts, pages, nil
+}
+
+func fileSignature(files ...[]templateFile) string {
+	var signature []byte
+	for _, list := range files {
+		for _, f := range list {
+			signature = fmt.Appendf(signature, "%s|%d;", f.path, f.modTime().UnixNano())
+		}
+	}
+	return string(signature)
+}
+
+// 解析所有模板，解析失败时保留之前的模板
+func (t *TemplateSet) Load() error {
+	layouts, pages, err := t.files()
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		return errors.New("no page template matched")
+	}
+	base := template.New("").Funcs(ContextFuncMap(nil)).Funcs(t.options.FuncMap)
+	for _, f := range layouts {
+		if err := parseFile(base, f); err != nil {
+			return err
+		}
+	}
+	parsed := make(map[string]*template.Template, len(pages))
+	contexts := make(map[string]*contextTemplates, len(pages))
+	for _, f := range pages {
+		page, err := base.Clone()
+		if err != nil {
+			return err
+		}
+		if funcs, ok := t.options.Funcs[f.name()]; ok {
+			page.Funcs(funcs)
+		}
+		if err := parseFile(page, f); err != nil {
+			return err
+		}
+		parsed[f.name()] = page
+		pristine, err := page.Clone()
+		if err != nil {
+			return err
+		}
+		contexts[f.name()] = newContextTemplates(pristine)
+	}
+	t.lock.Lock()
+	t.pages = parsed
+	t.contexts = contexts
+	t.signature = fileSignature(layouts, pages)
+	t.lock.Unlock()
+	return nil
+}
+
+func parseFile(t *template.Template, f templateFile) error {
+	content, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, err = t.New(f.name()).Parse(string(content)); err != nil {
+		return fmt.Errorf("parse template [%s]: %w", f.path, err)
+	}
+	return nil
+}
+
+// 开发模式下模板文件新增，删除或者修改时重新解析
+func (t *TemplateSet) reloadIfChanged() error {
+	layouts, pages, err := t.files()
+	if err != nil {
+		return err
+	}
+	t.lock.RLock()
+	changed := fileSignature(layouts, pages) != t.signature
+	t.lock.RUnlock()
+	if !changed {
+		return nil
+	}
+	return t.Load()
+}
+
+// 获取页面名称对应的模板，执行时使用页面名称，ExecuteTemplate(w, name, data)
+func (t *TemplateSet) Lookup(name string) (*template.Template, error) {
+	if t.options.Dev {
+		if err := t.reloadIfChanged(); err != nil {
+			return nil, err
+		}
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	page, ok := t.pages[name]
+	if !ok {
+		return nil, fmt.Errorf("html template [%s] not found", name)
+	}
+	return page, nil
+}
+
+// 创建页面模板的Render，模板中可以通过{{ctx "csrf_token"}}获取上下文中的值，TemplateSet本身也可以作为HTMLRenderer
+// 调用方式:engine.SetHTMLRenderer(set)
+func (t *TemplateSet) Instance(name string, data any, rc *RenderContext) Render {
+	page, err := t.Lookup(name)
+	if err != nil {
+		return errorRender{err: err}
+	}
+	t.lock.RLock()
+	contexts := t.contexts[name]
+	t.lock.RUnlock()
+	return contextRender(page, contexts, name, data, rc)
+}
@@ -0,0 +1,24 @@
+package lora_render
+
+import (
+	"bytes"
+	"github.com/BurntSushi/toml"
+	"net/http"
+)
+
+type TomlRender struct {
+	Data any
+}
+
+var tomlContentType = "application/toml; charset=utf-8"
+
+func (t *TomlRender) Render(w http.ResponseWriter, status int) error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(t.Data); err != nil {
+		return err
+	}
+	writeContentType(w, tomlContentType)
+	w.WriteHeader(status)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
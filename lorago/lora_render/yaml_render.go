@@ -0,0 +1,23 @@
+package lora_render
+
+import (
+	"gopkg.in/yaml.v3"
+	"net/http"
+)
+
+type YamlRender struct {
+	Data any
+}
+
+var yamlContentType = "application/yaml; charset=utf-8"
+
+func (y *YamlRender) Render(w http.ResponseWriter, status int) error {
+	data, err := yaml.Marshal(y.Data)
+	if err != nil {
+		return err
+	}
+	writeContentType(w, yamlContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(data)
+	return err
+}
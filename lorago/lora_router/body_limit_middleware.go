@@ -0,0 +1,17 @@
+package lora_router
+
+/*
+*@Author: LorraineWen
+*限制单个路由或者路由组的请求体大小，超过限制时读取请求体会失败，错误处理函数会返回413
+*会覆盖engine.SetMaxBodySize设置的全局限制
+ */
+
+// 调用方式:userGroup.Post("/import", importHandler, lorago.BodyLimitMiddleware(100<<20))
+func BodyLimitMiddleware(n int64) MiddlewareFunc {
+	return func(next HandleFunc) HandleFunc {
+		return func(ctx *Context) {
+			ctx.SetMaxBodySize(n)
+			next(ctx)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package lora_router
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"github.com/LorraineWen/lorago/lora_cache"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*响应缓存中间件，只缓存GET请求
+*缓存的key由请求方法，路径和指定的请求参数，请求头组成
+*缓存状态码，响应头和响应体，缓存接口可以自定义，默认使用内存中的LRU缓存
+*客户端发送Cache-Control: no-cache时跳过缓存重新计算
+*响应带有Vary时，只有Vary中的请求头都在HeaderKeys中才会缓存，Vary: *的响应不缓存
+*根据响应体生成ETag，支持If-None-Match返回304
+ */
+const (
+	defaultCacheCapacity = 1024
+	defaultCacheTTL      = time.Minute
+)
+
+type CacheEntity struct {
+	Store      lora_cache.Cache //为空时使用容量为1024的LRU缓存
+	TTL        time.Duration    //为0时使用1分钟
+	QueryKeys  []string         //参与生成缓存key的请求参数
+	HeaderKeys []string         //参与生成缓存key的请求头，比如Accept-Language，需要缓存Negotiate的响应时加入Accept
+	//判断响应是否需要缓存，为空时只缓存200
+	ShouldCache func(status int, header http.Header) bool
+	storeOnce   sync.Once
+}
+
+// 缓存的响应
+type cachedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// 调用方式:
+// cache := &lorago.CacheEntity{TTL: 5 * time.Minute, QueryKeys: []string{"page"}}
+// userGroup.Get("/list", listHandler, cache.CacheMiddleware)
+func (c *CacheEntity) CacheMiddleware(next HandleFunc) HandleFunc {
+	c.storeOnce.Do(func() {
+		if c.Store == nil {
+			c.Store = lora_cache.NewLRUCache(defaultCacheCapacity)
+		}
+	})
+	return func(ctx *Context) {
+		if ctx.R.Method != http.MethodGet {
+			next(ctx)
+			return
+		}
+		key := c.cacheKey(ctx.R)
+		requestCacheControl := ctx.R.Header.Get("Cache-Control")
+		//客户端要求不使用缓存时，重新计算并更新缓存
+		if !hasCacheDirective(requestCacheControl, "no-cache") {
+			if data, ok := c.Store.Get(key); ok {
+				resp := &cachedResponse{}
+				if err := gob.NewDecoder(bytes.NewReader(data)).Decode(resp); err == nil {
+					c.writeResponse(ctx, resp)
+					return
+				}
+				c.Store.Delete(key)
+			}
+		}
+		w := ctx.W
+		recorder := &responseRecorder{header: make(http.Header), status: http.StatusOK}
+		ctx.W = recorder
+		next(ctx)
+		ctx.W = w
+		resp := &cachedResponse{Status: recorder.status, Header: recorder.header, Body: recorder.body.Bytes()}
+		if resp.Status == http.StatusOK && resp.Header.Get("ETag") == "" {
+			resp.Header.Set("ETag", generateETag(resp.Body))
+		}
+		if !hasCacheDirective(requestCacheControl, "no-store") && c.shouldCache(resp) {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(resp); err == nil {
+				ttl := c.TTL
+				if ttl <= 0 {
+					ttl = defaultCacheTTL
+				}
+				c.Store.Set(key, buf.Bytes(), ttl)
+			}
+		}
+		c.writeResponse(ctx, resp)
+	}
+}
+
+func (c *CacheEntity) shouldCache(resp *cachedResponse) bool {
+	//设置了cookie或者禁止缓存的响应不能缓存
+	if resp.Header.Get("Set-Cookie") != "" {
+		return false
+	}
+	cacheControl := resp.Header.Get("Cache-Control")
+	if hasCacheDirective(cacheControl, "no-store") || hasCacheDirective(cacheControl, "private") {
+		return false
+	}
+	//响应随请求头变化，但是缓存key中没有这些请求头时，不同的请求会拿到同一份缓存
+	if !c.varyCovered(resp.Header) {
+		return false
+	}
+	if c.ShouldCache != nil {
+		return c.ShouldCache(resp.Status, resp.Header)
+	}
+	return resp.Status == http.StatusOK
+}
+
+// 将响应写回客户端，ETag匹配时返回304
+func (c *CacheEntity) writeResponse(ctx *Context, resp *cachedResponse) {
+	header := ctx.W.Header()
+	for key, values := range resp.Header {
+		header[key] = values
+	}
+	etag := resp.Header.Get("ETag")
+	if etag != "" && etagMatch(ctx.R.Header.Get("If-None-Match"), etag) {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		ctx.W.WriteHeader(http.StatusNotModified)
+		ctx.StatusCode = http.StatusNotModified
+		return
+	}
+	ctx.W.WriteHeader(resp.Status)
+	ctx.StatusCode = resp.Status
+	ctx.W.Write(resp.Body)
+}
+
+func (c *CacheEntity) cacheKey(r *http.Request) string {
+	var sb strings.Builder
+	sb.WriteString(r.Method)
+	sb.WriteString(" ")
+	sb.WriteString(r.URL.Path)
+	query := r.URL.Query()
+	for _, key := range c.QueryKeys {
+		sb.WriteString("|q:" + key + "=" + strings.Join(query[key], ","))
+	}
+	for _, key := range c.HeaderKeys {
+		sb.WriteString("|h:" + key + "=" + strings.Join(r.Header.Values(key), ","))
+	}
+	return sb.String()
+}
+
+// 判断Vary中的请求头是否都参与了缓存key的生成
+func (c *CacheEntity) varyCovered(header http.Header) bool {
+	for _, vary := range header.Values("Vary") {
+		for _, name := range strings.Split(vary, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" {
+				return false
+			}
+			covered := false
+			for _, key := range c.HeaderKeys {
+				if strings.EqualFold(key, name) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func generateETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// 判断If-None-Match中是否包含etag，忽略弱校验前缀W/
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, value := range strings.Split(ifNoneMatch, ",") {
+		value = strings.TrimSpace(value)
+		if value == "*" || strings.TrimPrefix(value, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// 判断Cache-Control中是否包含指定的指令
+func hasCacheDirective(cacheControl, directive string) bool {
+	for _, value := range strings.Split(cacheControl, ",") {
+		value = strings.TrimSpace(value)
+		if i := strings.IndexByte(value, '='); i >= 0 {
+			value = value[:i]
+		}
+		if strings.EqualFold(value, directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// 暂存处理函数写入的响应，由缓存中间件决定如何写回客户端
+type responseRecorder struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(data)
+}
@@ -0,0 +1,139 @@
+package lora_router
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+/*
+*@Author: LorraineWen
+*获取客户端的真实ip，只有请求来自可信的代理时才读取X-Forwarded-For等请求头
+*X-Forwarded-For从右往左查找，跳过可信的代理，第一个不可信的ip就是客户端的ip
+*左边的ip可以被客户端伪造，所以不能直接使用最左边的ip
+ */
+var defaultRemoteIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// 设置可信的代理，支持CIDR和单个ip，不设置时不信任任何代理，直接使用RemoteAddr
+// 调用方式:engine.SetTrustedProxies([]string{"10.0.0.0/8", "192.168.1.10"})
+func (e *Engine) SetTrustedProxies(proxies []string) error {
+	trusted := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		ipNet, err := parseCIDR(proxy)
+		if err != nil {
+			return err
+		}
+		trusted = append(trusted, ipNet)
+	}
+	e.trustedProxies = trusted
+	return nil
+}
+
+// 设置读取客户端ip的请求头，按顺序查找，默认是X-Forwarded-For和X-Real-IP
+// 调用方式:engine.SetRemoteIPHeaders("CF-Connecting-IP", "X-Forwarded-For")
+func (e *Engine) SetRemoteIPHeaders(headers ...string) {
+	e.remoteIPHeaders = headers
+}
+
+// 通过unix domain socket部署在nginx等反向代理后面时，RemoteAddr是@或者空字符串，ClientIP无法得到ip，ip过滤中间件会拒绝所有请求
+// 设置为true之后信任unix socket的对端，和可信代理一样从X-Forwarded-For等请求头中获取客户端的ip
+// 调用方式:engine.SetTrustUnixSocket(true)
+func (e *Engine) SetTrustUnixSocket(trust bool) {
+	e.trustUnixSocket = trust
+}
+
+// 单个ip转换为/32或者/128的网段
+func parseCIDR(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ip [%s]", value)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(value)
+	return ipNet, err
+}
+
+func (e *Engine) isTrustedProxy(ip net.IP) bool {
+	for _, ipNet := range e.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 获取客户端的ip
+// 调用方式:ip := context.ClientIP()
+func (ctx *Context) ClientIP() string {
+	remoteIP := ctx.RemoteIP()
+	if !ctx.fromTrustedPeer(remoteIP) {
+		return remoteIP
+	}
+	headers := ctx.engine.remoteIPHeaders
+	if headers == nil {
+		headers = defaultRemoteIPHeaders
+	}
+	for _, header := range headers {
+		if clientIP, ok := ctx.engine.clientIPFromHeader(ctx.R.Header, header); ok {
+			return clientIP
+		}
+	}
+	return remoteIP
+}
+
+// 对端是可信的代理或者是可信的unix socket时才读取请求头
+func (ctx *Context) fromTrustedPeer(remoteIP string) bool {
+	if ctx.engine == nil {
+		return false
+	}
+	if ctx.engine.trustUnixSocket && ctx.fromUnixSocket() {
+		return true
+	}
+	ip := net.ParseIP(remoteIP)
+	return ip != nil && ctx.engine.isTrustedProxy(ip)
+}
+
+// http.Server会把监听的地址放到请求的context中
+func (ctx *Context) fromUnixSocket() bool {
+	addr, ok := ctx.R.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// 从右往左查找第一个不可信的ip，所有ip都可信时使用最左边的ip，存在非法的ip时忽略该请求头
+func (e *Engine) clientIPFromHeader(header http.Header, name string) (string, bool) {
+	values := header.Values(name)
+	if len(values) == 0 {
+		return "", false
+	}
+	//同一个请求头出现多次时按照顺序拼接
+	items := strings.Split(strings.Join(values, ","), ",")
+	for i := len(items) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(items[i]))
+		if ip == nil {
+			return "", false
+		}
+		if i == 0 || !e.isTrustedProxy(ip) {
+			return ip.String(), true
+		}
+	}
+	return "", false
+}
+
+// 获取直接连接的对端ip，也就是RemoteAddr中的ip，unix socket连接时是@或者空字符串
+func (ctx *Context) RemoteIP() string {
+	remoteAddr := strings.TrimSpace(ctx.R.RemoteAddr)
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return ip
+}
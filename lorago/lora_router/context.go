@@ -1,19 +1,25 @@
 package lora_router
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/LorraineWen/lorago/lora_bind"
 	"github.com/LorraineWen/lorago/lora_log"
 	"github.com/LorraineWen/lorago/lora_render"
+	"github.com/LorraineWen/lorago/lora_session"
+	"github.com/LorraineWen/lorago/lora_upload"
 	"github.com/LorraineWen/lorago/lora_util"
+	"html"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 /*
@@ -24,29 +30,104 @@ import (
 *支持下载文件的需求，可以自定义下载的文件的名称
 *支持json格式，切片格式的请求参数解析
  */
-const defaultMultipartMemory = 30 << 20 //30MB大小用来加载post表单里面的参数到内存
-
 type Context struct {
 	W                     http.ResponseWriter
 	R                     *http.Request
-	engine                *Engine          //用于获取模板渲染函数
-	StatusCode            int              //存放响应结果
-	queryCache            url.Values       //用于获取请求路径中的参数，实际上就是map[string[]string
-	formCache             url.Values       //用于获取post请求中的表单数据
-	DisallowUnknownFields bool             //设置参数属性检查，json参数中有的属性，如果绑定的结构体没有就报错
-	Validate              bool             //设置结构体属性检查，如果json参数中没有该结构体的相应属性，那么就会报错
-	ValidateAnother       bool             //启用第三方的校验
-	Logger                *lora_log.Logger //日志模块
-	basicKeys             map[string]any   //用于basic身份验证，实际上是通过中间件实现basic验证
-	rwMutex               sync.RWMutex     //用于basic身份验证的读写锁
-	sameSite              http.SameSite    //用于jwt验证的安全验证
+	engine                *Engine               //用于获取模板渲染函数
+	StatusCode            int                   //存放响应结果
+	queryCache            url.Values            //用于获取请求路径中的参数，实际上就是map[string[]string
+	formCache             url.Values            //用于获取post请求中的表单数据
+	DisallowUnknownFields bool                  //设置参数属性检查，json参数中有的属性，如果绑定的结构体没有就报错
+	Validate              bool                  //设置结构体属性检查，json，表单和请求路径参数中没有binding:"required"的属性时报错
+	ValidateAnother       bool                  //启用第三方的校验
+	Logger                *lora_log.Logger      //日志模块
+	basicKeys             map[string]any        //用于basic身份验证，实际上是通过中间件实现basic验证
+	rwMutex               sync.RWMutex          //用于basic身份验证的读写锁
+	sameSite              http.SameSite         //用于jwt验证的安全验证
+	streaming             bool                  //事件流的响应头是否已经写入
+	params                map[string]string     //路由参数，/get/:id中的id
+	rawBody               io.ReadCloser         //没有经过大小限制的原始请求体
+	errs                  []error               //处理请求过程中产生的错误，比如渲染失败，会输出到日志中
+	templateValues        map[string]any        //模板中通过{{ctx "key"}}获取的值，比如csrf token和当前用户
+	session               *lora_session.Session //会话中间件加载的Session
 }
 
 // 一个多态函数，htmlRender等结构体实现了Render函数，因此可以传入htmlRender等接口体，调用它们自己的Render函数，编码html等响应格式
+// 先渲染到缓冲区，渲染失败时丢弃已经渲染的内容，通过engine的errHandler返回500，错误会记录到日志中
+// 响应体超过engine.SetRenderBufferSize设置的大小之后直接写给客户端，这之后渲染失败只能记录到日志中
 func (ctx *Context) Render(status int, r lora_render.Render) error {
-	err := r.Render(ctx.W, status)
+	buf := newRenderBuffer(ctx.W, ctx.renderBufferSize())
+	defer buf.release()
+	err := r.Render(buf, status)
+	ctx.StatusCode = buf.status
+	if err != nil {
+		err = fmt.Errorf("render %T failed: %w", r, err)
+		ctx.AddError(err)
+		if !buf.streaming {
+			ctx.renderError(err)
+		}
+		return err
+	}
+	return buf.flushTo()
+}
+
+func (ctx *Context) renderBufferSize() int {
+	if ctx.engine != nil && ctx.engine.renderBufferSize != 0 {
+		return ctx.engine.renderBufferSize
+	}
+	return defaultRenderBufferSize
+}
+
+// 渲染失败时交给errHandler的错误，Error只返回500对应的描述，避免把模板和编码的内部错误返回给客户端
+// 原始的错误可以通过errors.As或者errors.Unwrap获取，完整的错误信息会记录到日志中
+type RenderError struct {
+	Err error
+}
+
+func (e *RenderError) Error() string {
+	return http.StatusText(http.StatusInternalServerError)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// 渲染失败时返回的响应，errHandler返回的数据也无法编码时直接返回500
+func (ctx *Context) renderError(err error) {
+	status, data := http.StatusInternalServerError, any(nil)
+	if ctx.engine != nil && ctx.engine.errHandler != nil {
+		status, data = ctx.engine.errHandler(&RenderError{Err: err})
+	}
+	//渲染失败一般是服务端的问题，不使用errHandler返回的4xx
+	if status < http.StatusInternalServerError {
+		status = http.StatusInternalServerError
+	}
+	ctx.W.Header().Del("Content-Disposition")
+	buf := newRenderBuffer(ctx.W, ctx.renderBufferSize())
+	defer buf.release()
+	if data == nil || (&lora_render.JsonRender{Data: data}).Render(buf, status) != nil || buf.streaming {
+		if !buf.streaming {
+			ctx.W.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			ctx.W.WriteHeader(status)
+			ctx.W.Write([]byte(http.StatusText(status)))
+		}
+		ctx.StatusCode = status
+		return
+	}
 	ctx.StatusCode = status
-	return err
+	buf.flushTo()
+}
+
+// 记录处理请求过程中产生的错误，日志中间件会输出这些错误
+func (ctx *Context) AddError(err error) {
+	if err != nil {
+		ctx.errs = append(ctx.errs, err)
+	}
+}
+
+// 获取处理请求过程中产生的错误
+func (ctx *Context) Errors() []error {
+	return ctx.errs
 }
 
 // 支持html格式响应
@@ -57,11 +138,57 @@ func (ctx *Context) HtmlResponseWrite(status int, data any) error {
 
 // 支持json格式响应
 // 调用方式context.JsonResponseWrite(http.StatusOK, &User{Name: "amie"})
+// 调试模式下输出缩进的json
 func (ctx *Context) JsonResponseWrite(status int, data any) error {
+	if ctx.engine != nil && ctx.engine.debugMode {
+		return ctx.IndentedJsonResponseWrite(status, data)
+	}
 	err := ctx.Render(status, &lora_render.JsonRender{Data: data})
 	return err
 }
 
+// 支持缩进的json格式响应
+// 调用方式context.IndentedJsonResponseWrite(http.StatusOK, &User{Name: "amie"})
+func (ctx *Context) IndentedJsonResponseWrite(status int, data any) error {
+	return ctx.Render(status, &lora_render.IndentedJsonRender{Data: data})
+}
+
+// 支持安全json格式响应，数组会加上前缀防止json劫持
+// 调用方式context.SecureJsonResponseWrite(http.StatusOK, []string{"a", "b"})
+func (ctx *Context) SecureJsonResponseWrite(status int, data any) error {
+	prefix := ""
+	if ctx.engine != nil {
+		prefix = ctx.engine.secureJsonPrefix
+	}
+	return ctx.Render(status, &lora_render.SecureJsonRender{Prefix: prefix, Data: data})
+}
+
+// 支持jsonp格式响应，回调函数名称从请求参数callback中获取，没有时返回普通json
+// 调用方式context.JsonpResponseWrite(http.StatusOK, &User{Name: "amie"})
+func (ctx *Context) JsonpResponseWrite(status int, data any) error {
+	key := "callback"
+	if ctx.engine != nil && ctx.engine.jsonpCallbackKey != "" {
+		key = ctx.engine.jsonpCallbackKey
+	}
+	callback := ctx.R.URL.Query().Get(key)
+	if callback != "" && !lora_render.IsValidJsonpCallback(callback) {
+		return ctx.Render(http.StatusBadRequest, &lora_render.JsonRender{Data: map[string]any{"code": http.StatusBadRequest, "msg": "invalid jsonp callback"}})
+	}
+	return ctx.Render(status, &lora_render.JsonpRender{Callback: callback, Data: data})
+}
+
+// 支持非ascii字符转义为\uXXXX的json格式响应
+// 调用方式context.AsciiJsonResponseWrite(http.StatusOK, map[string]string{"name": "小明"})
+func (ctx *Context) AsciiJsonResponseWrite(status int, data any) error {
+	return ctx.Render(status, &lora_render.AsciiJsonRender{Data: data})
+}
+
+// 支持不转义html字符的json格式响应
+// 调用方式context.PureJsonResponseWrite(http.StatusOK, map[string]string{"html": "<b>amie</b>"})
+func (ctx *Context) PureJsonResponseWrite(status int, data any) error {
+	return ctx.Render(status, &lora_render.PureJsonRender{Data: data})
+}
+
 // 支持xml格式响应
 // 调用方式context.Xml(http.StatusOK, &User{Name: "amie"})
 func (ctx *Context) XmlResponseWrite(status int, data any) error {
@@ -69,6 +196,86 @@ func (ctx *Context) XmlResponseWrite(status int, data any) error {
 	return err
 }
 
+// 支持protobuf格式响应，data必须实现proto.Message
+// 调用方式context.ProtoBuf(http.StatusOK, &pb.User{Name: "amie"})
+func (ctx *Context) ProtoBuf(status int, data any) error {
+	return ctx.Render(status, &lora_render.ProtoBufRender{Data: data})
+}
+
+// 支持msgpack格式响应
+// 调用方式context.MsgPack(http.StatusOK, &User{Name: "amie"})
+func (ctx *Context) MsgPack(status int, data any) error {
+	return ctx.Render(status, &lora_render.MsgPackRender{Data: data})
+}
+
+// 支持yaml格式响应
+// 调用方式context.YAML(http.StatusOK, &User{Name: "amie"})
+func (ctx *Context) YAML(status int, data any) error {
+	return ctx.Render(status, &lora_render.YamlRender{Data: data})
+}
+
+// 支持toml格式响应，data必须是结构体或者map
+// 调用方式context.TOML(http.StatusOK, &User{Name: "amie"})
+func (ctx *Context) TOML(status int, data any) error {
+	return ctx.Render(status, &lora_render.TomlRender{Data: data})
+}
+
+// 内容协商时html格式使用的模板，其余格式使用Data
+type HTMLData struct {
+	Name string //模板名称
+	Data any
+}
+
+// 内容协商时默认提供的格式
+var defaultOffered = []string{
+	lora_render.MIMEJSON,
+	lora_render.MIMEXML,
+	lora_render.MIMEYAML,
+	lora_render.MIMETOML,
+	lora_render.MIMEMSGPACK,
+}
+
+// 根据Accept请求头选择响应格式，offered为空时提供json，xml，yaml，toml和msgpack
+// 都不匹配时使用engine.SetNegotiateDefault设置的格式，没有设置或者选中的格式没有注册Render时写入406，返回lora_render.ErrNotAcceptable
+// 需要返回html时，data传入HTMLData，html使用模板渲染，其余格式使用HTMLData.Data
+// 不是HTMLData时html格式输出转义之后的fmt.Sprint(data)
+// 调用方式:
+// context.Negotiate(http.StatusOK, lorago.HTMLData{Name: "user.html", Data: user}, lora_render.MIMEJSON, lora_render.MIMEHTML)
+func (ctx *Context) Negotiate(status int, data any, offered ...string) error {
+	if len(offered) == 0 {
+		offered = defaultOffered
+	}
+	ctx.W.Header().Add("Vary", "Accept")
+	mediaType := lora_render.NegotiateContentType(ctx.R.Header.Get("Accept"), offered)
+	if mediaType == "" && ctx.engine != nil {
+		mediaType = ctx.engine.negotiateDefault
+	}
+	if mediaType == "" {
+		return ctx.notAcceptable()
+	}
+	htmlData, isHTMLData := data.(HTMLData)
+	if isHTMLData {
+		data = htmlData.Data
+	}
+	if mediaType == lora_render.MIMEHTML {
+		if isHTMLData {
+			return ctx.TemplateResponseWrite(status, htmlData.Name, htmlData.Data)
+		}
+		//没有模板时把数据转义之后作为html输出，避免数据中的内容被浏览器当作html执行
+		return ctx.HtmlResponseWrite(status, html.EscapeString(fmt.Sprint(data)))
+	}
+	r, ok := lora_render.NewRender(mediaType, data)
+	if !ok {
+		return ctx.notAcceptable()
+	}
+	return ctx.Render(status, r)
+}
+
+func (ctx *Context) notAcceptable() error {
+	ctx.Fail(http.StatusNotAcceptable, lora_render.ErrNotAcceptable.Error())
+	return lora_render.ErrNotAcceptable
+}
+
 // 支持格式化String格式响应
 // 调用方式context.StringResponseWrite(http.StatusOK, "你好 %s", "amie")
 func (ctx *Context) StringResponseWrite(status int, format string, data ...any) (err error) {
@@ -79,7 +286,7 @@ func (ctx *Context) StringResponseWrite(status int, format string, data ...any)
 	return
 }
 
-// 配合e.LoadTemplate函数使用，engine.LoadTemplate初始化 ctx.engine.htmlRender.Template，Template只需要传递该模板需要的数据
+// 配合e.LoadTemplate函数使用，通过engine的HTMLRenderer渲染模板，Template只需要传递该模板需要的数据
 // 调用方式:
 // engine.LoadTemplate("../test/template/*.html")
 //
@@ -89,13 +296,17 @@ func (ctx *Context) StringResponseWrite(status int, format string, data ...any)
 //
 // name是../test/template目录下的具体html文件的名称
 func (ctx *Context) TemplateResponseWrite(status int, name string, data any) error {
-	err := ctx.Render(status, &lora_render.HtmlRender{
-		IsTemplate: true,
-		Name:       name,
-		Data:       data,
-		Template:   ctx.engine.htmlRender.Template,
-	})
-	return err
+	rc := &lora_render.RenderContext{Request: ctx.R, Values: ctx.templateValues}
+	return ctx.Render(status, ctx.engine.htmlRender.Instance(name, data, rc))
+}
+
+// 设置当前请求的模板上下文，模板中通过{{ctx "user"}}获取
+// 调用方式:context.SetTemplateValue("user", currentUser)
+func (ctx *Context) SetTemplateValue(key string, value any) {
+	if ctx.templateValues == nil {
+		ctx.templateValues = make(map[string]any)
+	}
+	ctx.templateValues[key] = value
 }
 
 // 支持文件下载
@@ -105,12 +316,17 @@ func (ctx *Context) FileResponseWrite(filePath string) {
 
 // 支持自定义文件名称下载，下载好的文件名称自动变为filename
 func (ctx *Context) FileAttachmentResponseWrite(filepath, filename string) {
+	ctx.setContentDisposition("attachment", filename)
+	http.ServeFile(ctx.W, ctx.R, filepath)
+}
+
+// 设置Content-Disposition，非ascii的文件名称使用UTF-8编码
+func (ctx *Context) setContentDisposition(disposition, filename string) {
 	if lora_util.IsASCII(filename) {
-		ctx.W.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		ctx.W.Header().Set("Content-Disposition", disposition+`; filename="`+filename+`"`)
 	} else {
-		ctx.W.Header().Set("Content-Disposition", `attachment; filename*=UTF-8''`+url.QueryEscape(filename))
+		ctx.W.Header().Set("Content-Disposition", disposition+`; filename*=UTF-8''`+url.QueryEscape(filename))
 	}
-	http.ServeFile(ctx.W, ctx.R, filepath)
 }
 
 // 从本地文件系统下载文件，fileSystem实际上就是一个本地的目录http.Dir("../test/template")
@@ -134,6 +350,117 @@ func (ctx *Context) Redirect(status int, location string) {
 	http.Redirect(ctx.W, ctx.R, location, status)
 }
 
+// 支持Server-Sent Events，发送一个事件并立即刷新到客户端
+// 第一次调用时会写入事件流的响应头
+// 调用方式:context.SSE(lora_render.SSEvent{Event: "message", Data: "hello"})
+func (ctx *Context) SSE(event lora_render.SSEvent) error {
+	ctx.startStream()
+	if err := event.Encode(ctx.W); err != nil {
+		return err
+	}
+	return ctx.flush()
+}
+
+// 支持流式响应，step每返回一次就刷新一次，step返回false或者客户端断开连接时结束
+// step的第一个参数是请求的context，客户端断开连接时会被取消
+// step内部阻塞等待数据时需要同时监听reqCtx.Done()，否则要等到下一次写入失败才能发现客户端已经断开
+// 返回值表示是否是因为客户端断开连接而结束的
+// 调用方式:
+//
+//	context.Stream(func(reqCtx context.Context, w io.Writer) bool {
+//		select {
+//		case <-reqCtx.Done():
+//			return false
+//		case msg, ok := <-messages:
+//			if !ok {
+//				return false
+//			}
+//			context.SSE(lora_render.SSEvent{Data: msg})
+//			return true
+//		}
+//	})
+func (ctx *Context) Stream(step func(reqCtx context.Context, w io.Writer) bool) bool {
+	ctx.startStream()
+	//先把响应头发送给客户端，step可能要等待一段时间才有数据
+	if err := ctx.flush(); err != nil {
+		return true
+	}
+	reqCtx := ctx.R.Context()
+	for {
+		if reqCtx.Err() != nil {
+			return true
+		}
+		keepOpen := step(reqCtx, ctx.W)
+		if reqCtx.Err() != nil {
+			return true
+		}
+		if err := ctx.flush(); err != nil {
+			return true
+		}
+		if !keepOpen {
+			return false
+		}
+	}
+}
+
+// 将channel中的事件依次发送给客户端，channel关闭或者客户端断开连接时结束
+// keepAlive大于0时，空闲keepAlive时间后发送一条注释作为心跳
+// 返回值表示是否是因为客户端断开连接而结束的
+func (ctx *Context) SSEStream(events <-chan lora_render.SSEvent, keepAlive time.Duration) bool {
+	ctx.startStream()
+	if err := ctx.flush(); err != nil {
+		return true
+	}
+	var tick <-chan time.Time
+	if keepAlive > 0 {
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	done := ctx.R.Context().Done()
+	for {
+		select {
+		case <-done:
+			return true
+		case <-tick:
+			if err := lora_render.WriteSSEComment(ctx.W, "keepalive"); err != nil {
+				return true
+			}
+			if err := ctx.flush(); err != nil {
+				return true
+			}
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			if err := ctx.SSE(event); err != nil {
+				return true
+			}
+		}
+	}
+}
+
+// 写入事件流的响应头，只会写入一次
+func (ctx *Context) startStream() {
+	if ctx.streaming {
+		return
+	}
+	ctx.streaming = true
+	lora_render.WriteSSEHeader(ctx.W)
+	ctx.W.WriteHeader(http.StatusOK)
+	ctx.StatusCode = http.StatusOK
+}
+
+// 将缓冲区中的数据立即发送给客户端
+func (ctx *Context) flush() error {
+	return http.NewResponseController(ctx.W).Flush()
+}
+
+// 获取路由参数，注册的路由为/get/:id，请求路径为/get/1时，Param("id")返回1
+func (ctx *Context) Param(key string) string {
+	return ctx.params[key]
+}
+
 // 将请求路径中的参数，按照map[string][]string的格式存储到c.queryCache中
 func (ctx *Context) initQueryCache() {
 	if ctx.R != nil {
@@ -160,7 +487,7 @@ func (ctx *Context) GetQueryArray(key string) (values []string, ok bool) {
 }
 
 // 获取map格式的请求参数/adduser?user[id]=1&user[name]=amie
-// 目前只能获取string:string类型的，可以进行数据转换支持更多类型
+// 只能获取string:string类型的，多层的参数使用GetQueryNestedMap
 // 调用方式:GetQueryMap("user")
 func (ctx *Context) GetQueryMap(key string) (map[string]string, bool) {
 	ctx.initQueryCache() //加载路径参数
@@ -193,7 +520,7 @@ func (ctx *Context) initFormCache() {
 	if ctx.formCache == nil {
 		ctx.formCache = make(url.Values)
 		req := ctx.R
-		if err := req.ParseMultipartForm(defaultMultipartMemory); err != nil {
+		if err := req.ParseMultipartForm(ctx.multipartMemory()); err != nil {
 			if !errors.Is(err, http.ErrNotMultipart) {
 				fmt.Println(err)
 			}
@@ -257,30 +584,66 @@ func (ctx *Context) DefaultFormQuery(key, defaultValue string) string {
 	return array[0]
 }
 func (ctx *Context) FormFile(name string) (*multipart.FileHeader, error) {
-	req := ctx.R
-	if err := req.ParseMultipartForm(defaultMultipartMemory); err != nil {
+	form, err := ctx.MultipartForm()
+	if err != nil {
 		return nil, err
 	}
-	file, header, err := req.FormFile(name)
+	if files := form.File[name]; len(files) > 0 {
+		return files[0], nil
+	}
+	return nil, http.ErrMissingFile
+}
+
+// 获取同一个字段的所有上传文件
+func (ctx *Context) FormFiles(name string) ([]*multipart.FileHeader, error) {
+	form, err := ctx.MultipartForm()
 	if err != nil {
 		return nil, err
 	}
-	err = file.Close()
+	if files := form.File[name]; len(files) > 0 {
+		return files, nil
+	}
+	return nil, http.ErrMissingFile
+}
+
+// 获取打开的上传文件，使用完之后需要调用file.Close()
+func (ctx *Context) OpenFormFile(name string) (multipart.File, *multipart.FileHeader, error) {
+	header, err := ctx.FormFile(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, header, nil
+}
+
+// 使用uploader保存指定字段的所有上传文件，fields为空时保存所有的上传文件
+// 调用方式:results, err := context.Upload(uploader, "avatar", "photos")
+func (ctx *Context) Upload(uploader *lora_upload.Uploader, fields ...string) ([]*lora_upload.Result, error) {
+	form, err := ctx.MultipartForm()
 	if err != nil {
 		return nil, err
 	}
-	return header, nil
+	return uploader.SaveAll(ctx.R.Context(), form, fields...)
 }
+
 func (ctx *Context) MultipartForm() (*multipart.Form, error) {
-	err := ctx.R.ParseMultipartForm(defaultMultipartMemory)
+	err := ctx.R.ParseMultipartForm(ctx.multipartMemory())
 	return ctx.R.MultipartForm, err
 }
+
+// 将上传文件保存到dst，会自动创建dst所在的目录，需要大小和类型限制时使用Upload
 func (ctx *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) error {
 	src, err := file.Open()
 	if err != nil {
 		return err
 	}
 	defer src.Close()
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
 	out, err := os.Create(dst)
 	if err != nil {
 		return err
@@ -290,20 +653,182 @@ func (ctx *Context) SaveUploadedFile(file *multipart.FileHeader, dst string) err
 	return err
 }
 
+// 限制请求体的大小，超过之后读取请求体会返回*http.MaxBytesError，错误处理函数会返回413
+// 会覆盖engine.SetMaxBodySize设置的限制，所以单个路由可以设置更大或者更小的限制，n小于等于0表示不限制
+func (ctx *Context) SetMaxBodySize(n int64) {
+	if ctx.rawBody == nil {
+		ctx.rawBody = ctx.R.Body
+	}
+	if ctx.rawBody == nil {
+		return
+	}
+	if n <= 0 {
+		ctx.R.Body = ctx.rawBody
+		return
+	}
+	ctx.R.Body = http.MaxBytesReader(ctx.W, ctx.rawBody, n)
+}
+
+// 判断错误是否是因为请求体超过了大小限制
+func IsBodyTooLarge(err error) bool {
+	var maxBytesError *http.MaxBytesError
+	return errors.As(err, &maxBytesError)
+}
+
+func (ctx *Context) multipartMemory() int64 {
+	if ctx.engine != nil && ctx.engine.maxMultipartMemory > 0 {
+		return ctx.engine.maxMultipartMemory
+	}
+	return lora_bind.DefaultMultipartMemory
+}
+
+// 逐个解码请求体中的json数组，不需要把整个数组加载到内存中，适用于批量导入
+// 调用方式:
+//
+//	decoder := context.JsonArrayDecoder()
+//	for decoder.More() {
+//		user := &User{}
+//		if err := decoder.Decode(user); err != nil {
+//			return
+//		}
+//	}
+//	//请求体不是json数组时More直接返回false，需要通过Err判断
+//	if err := decoder.Err(); err != nil {
+//		context.ErrorHandle(err)
+//	}
+func (ctx *Context) JsonArrayDecoder() *lora_bind.JsonArrayDecoder {
+	decoder := lora_bind.NewJsonArrayDecoder(ctx.R.Body)
+	decoder.DisallowUnknownFields = ctx.DisallowUnknownFields
+	decoder.Validate = ctx.ValidateAnother
+	return decoder
+}
+
 // 解析post请求中的json格式数据
 // 如果要解析属性校验，需要在注册路由的时候，将Validate两个bool值设置为true
 func (ctx *Context) BindJson(data any) error {
+	return ctx.MustBindWith(data, ctx.jsonBinder()) //多态底层调用json格式校验
+}
+
+// 根据Context中的校验设置生成json绑定器
+func (ctx *Context) jsonBinder() lora_bind.Binder {
 	jsonBinder := lora_bind.JsonBinder
 	jsonBinder.DisallowUnknownFields = ctx.DisallowUnknownFields
 	jsonBinder.IsValidate = ctx.Validate
 	jsonBinder.IsValidateAnother = ctx.ValidateAnother
-	return ctx.MustBindWith(data, jsonBinder) //多态底层调用json格式校验
+	return jsonBinder
+}
+
+// 根据请求方法和Content-Type自动选择绑定器，GET请求绑定请求路径中的参数
+// 绑定失败时直接通过errHandler返回错误响应，处理函数只需要在err不为nil时return
+// Content-Type不支持时返回415，请求体过大返回413，校验失败返回422，其余的绑定错误返回400
+// 调用方式:
+//
+//	if err := context.Bind(&user); err != nil {
+//		return
+//	}
+func (ctx *Context) Bind(obj any) error {
+	err := ctx.ShouldBind(obj)
+	if err != nil {
+		ctx.ErrorHandle(withBadRequest(err))
+	}
+	return err
+}
+
+// 和Bind一样选择绑定器，但是绑定失败时不写响应，由调用方自己处理错误
+// Content-Type不支持时返回*lora_bind.UnsupportedMediaTypeError
+func (ctx *Context) ShouldBind(obj any) error {
+	b, err := ctx.defaultBinder()
+	if err != nil {
+		return err
+	}
+	return ctx.ShouldBindWith(obj, b)
+}
+
+func (ctx *Context) defaultBinder() (lora_bind.Binder, error) {
+	b, err := lora_bind.Default(ctx.R.Method, ctx.R.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	switch b.Name() {
+	case lora_bind.JsonBinder.Name():
+		return ctx.jsonBinder(), nil
+	case lora_bind.FormBinder.Name():
+		return ctx.formBinder(), nil
+	case lora_bind.FormMultipartBinder.Name():
+		formMultipartBinder := lora_bind.FormMultipartBinder
+		formMultipartBinder.MaxMemory = ctx.multipartMemory()
+		formMultipartBinder.IsValidate = ctx.Validate
+		return formMultipartBinder, nil
+	case lora_bind.QueryBinder.Name():
+		return ctx.queryBinder(), nil
+	}
+	return b, nil
+}
+
+// 根据engine.SetMaxMultipartMemory的设置生成表单绑定器
+func (ctx *Context) formBinder() lora_bind.Binder {
+	formBinder := lora_bind.FormBinder
+	formBinder.MaxMemory = ctx.multipartMemory()
+	formBinder.IsValidate = ctx.Validate
+	return formBinder
+}
+
+func (ctx *Context) queryBinder() lora_bind.Binder {
+	queryBinder := lora_bind.QueryBinder
+	queryBinder.IsValidate = ctx.Validate
+	return queryBinder
 }
 
 // 支持xml格式校验
 func (ctx *Context) BindXml(obj any) error {
 	return ctx.MustBindWith(obj, lora_bind.XmlBinder)
 }
+
+// 支持表单格式绑定，包括multipart表单中的上传文件
+// 调用方式:context.BindForm(&user)
+func (ctx *Context) BindForm(obj any) error {
+	return ctx.MustBindWith(obj, ctx.formBinder())
+}
+
+// 支持请求路径参数绑定，通过query标签指定参数名称
+func (ctx *Context) BindQuery(obj any) error {
+	return ctx.MustBindWith(obj, ctx.queryBinder())
+}
+
+// 支持请求头绑定，通过header标签指定请求头名称
+func (ctx *Context) BindHeader(obj any) error {
+	return ctx.MustBindWith(obj, lora_bind.HeaderBinder)
+}
+
+// 支持cookie绑定，通过cookie标签指定cookie名称
+func (ctx *Context) BindCookie(obj any) error {
+	return ctx.MustBindWith(obj, lora_bind.CookieBinder)
+}
+
+// 支持路由参数绑定，通过uri标签指定参数名称
+// 调用方式:
+//
+//	userGroup.Get("/get/:id", func(context *lorago.Context) {
+//		user := &struct{ Id int `uri:"id"` }{}
+//		context.BindUri(user)
+//	})
+func (ctx *Context) BindUri(obj any) error {
+	return lora_bind.UriBinder.BindUri(ctx.uriParams(), obj)
+}
+
+// 同时绑定路由参数，请求路径参数，请求头和cookie，每个属性只从它的标签对应的来源中取值
+// 支持default标签设置默认值，绑定完成之后进行第三方校验
+func (ctx *Context) BindRequest(obj any) error {
+	return lora_bind.BindRequest(ctx.R, ctx.uriParams(), obj)
+}
+
+func (ctx *Context) uriParams() map[string][]string {
+	params := make(map[string][]string, len(ctx.params))
+	for key, value := range ctx.params {
+		params[key] = []string{value}
+	}
+	return params
+}
 func (ctx *Context) MustBindWith(obj any, b lora_bind.Binder) error {
 	//如果发生错误，返回400状态码 参数错误
 	if err := ctx.ShouldBindWith(obj, b); err != nil {
@@ -314,24 +839,81 @@ func (ctx *Context) MustBindWith(obj any, b lora_bind.Binder) error {
 func (ctx *Context) ShouldBindWith(obj any, b lora_bind.Binder) error {
 	return b.Bind(ctx.R, obj)
 }
+
+// 没有状态码的绑定错误，比如json格式错误，对应400状态码
+type badRequestError struct {
+	error
+}
+
+func (e badRequestError) Unwrap() error {
+	return e.error
+}
+
+func (e badRequestError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// 绑定错误本身带有状态码时保持不变，否则作为400处理
+func withBadRequest(err error) error {
+	var statusError interface{ StatusCode() int }
+	if errors.As(err, &statusError) || IsBodyTooLarge(err) {
+		return err
+	}
+	return badRequestError{err}
+}
+
 func (ctx *Context) Fail(status int, msg string) {
 	ctx.StringResponseWrite(status, msg)
 }
 
 // 支持httpcode的设置，可以在Header中设置状态码和code
 func (ctx *Context) ErrorHandle(err error) {
-	code, data := ctx.engine.errHandler(err)
+	code, data := ctx.engine.errHandler(ctx.localizeError(err))
 	ctx.JsonResponseWrite(code, data)
 }
 
 func (ctx *Context) HandlerWithError(code int, obj any, err error) {
 	if err != nil {
-		statusCode, data := ctx.engine.errHandler(err)
+		statusCode, data := ctx.engine.errHandler(ctx.localizeError(err))
 		ctx.JsonResponseWrite(statusCode, data)
 		return
 	}
 	ctx.JsonResponseWrite(code, obj)
 }
+
+// 校验错误根据请求头中的Accept-Language生成对应语言的错误信息
+func (ctx *Context) localizeError(err error) error {
+	validationErrors, ok := err.(lora_bind.ValidationErrors)
+	if !ok {
+		return err
+	}
+	locales := ctx.acceptLanguages()
+	if len(locales) == 0 {
+		return err
+	}
+	return validationErrors.Localize(locales...)
+}
+
+// 解析Accept-Language，zh-CN,zh;q=0.9,en;q=0.8解析为[zh_CN zh zh en]
+func (ctx *Context) acceptLanguages() []string {
+	header := ctx.R.Header.Get("Accept-Language")
+	if header == "" {
+		return nil
+	}
+	locales := make([]string, 0)
+	for _, value := range strings.Split(header, ",") {
+		locale := strings.TrimSpace(strings.SplitN(value, ";", 2)[0])
+		if locale == "" || locale == "*" {
+			continue
+		}
+		locale = strings.ReplaceAll(locale, "-", "_")
+		locales = append(locales, locale)
+		if index := strings.IndexByte(locale, '_'); index > 0 {
+			locales = append(locales, locale[:index])
+		}
+	}
+	return locales
+}
 func (ctx *Context) BasicSet(key string, value any) {
 	ctx.rwMutex.Lock()
 	defer ctx.rwMutex.Unlock()
@@ -347,6 +929,99 @@ func (ctx *Context) BasicGet(key string) (value any, exist bool) {
 	return
 }
 
+// 获取指定类型的值，值不存在或者类型不一致时ok为false
+// 调用方式:user, ok := lorago.Get[*User](context, "user")
+func Get[T any](ctx *Context, key string) (value T, ok bool) {
+	v, exist := ctx.BasicGet(key)
+	if !exist {
+		return value, false
+	}
+	value, ok = v.(T)
+	return value, ok
+}
+
+// 和Get一样，值不存在或者类型不一致时panic，会被recovery中间件捕获
+// 调用方式:user := lorago.MustGet[*User](context, "user")
+func MustGet[T any](ctx *Context, key string) T {
+	v, exist := ctx.BasicGet(key)
+	if !exist {
+		panic(fmt.Sprintf("key [%s] does not exist", key))
+	}
+	value, ok := v.(T)
+	if !ok {
+		var zero T
+		panic(fmt.Sprintf("key [%s] is %T, not %T", key, v, zero))
+	}
+	return value
+}
+
+// 以下四个函数让Context实现了context.Context，可以直接传给需要context.Context的库
+// 超时和取消使用请求的context，Value优先从BasicSet设置的值中查找
+//
+// 注意:Context会被放回pool给下一个请求复用，handler返回之后不能再使用Context，也不能把它交给还在运行的goroutine
+// 需要在handler返回之后继续运行的goroutine，应该在handler内部取出context.R.Context()传递下去
+// 调用方式:
+//
+//	reqCtx := context.R.Context()
+//	go func() {
+//		<-reqCtx.Done()
+//	}()
+//
+// 没有关联请求的Context和context.Background()一样，Done返回nil，Err返回nil
+func (ctx *Context) Deadline() (deadline time.Time, ok bool) {
+	if ctx.R == nil {
+		return
+	}
+	return ctx.R.Context().Deadline()
+}
+
+func (ctx *Context) Done() <-chan struct{} {
+	if ctx.R == nil {
+		return nil
+	}
+	return ctx.R.Context().Done()
+}
+
+func (ctx *Context) Err() error {
+	if ctx.R == nil {
+		return nil
+	}
+	return ctx.R.Context().Err()
+}
+
+func (ctx *Context) Value(key any) any {
+	if k, ok := key.(string); ok {
+		if value, exist := ctx.BasicGet(k); exist {
+			return value
+		}
+	}
+	if ctx.R == nil {
+		return nil
+	}
+	return ctx.R.Context().Value(key)
+}
+
+// 清空上一个请求留下的数据，Context从pool中取出之后调用
+func (ctx *Context) reset(w http.ResponseWriter, r *http.Request) {
+	ctx.W = w
+	ctx.R = r
+	ctx.StatusCode = 0
+	ctx.queryCache = nil
+	ctx.formCache = nil
+	ctx.DisallowUnknownFields = false
+	ctx.Validate = false
+	ctx.ValidateAnother = false
+	ctx.Logger = nil
+	ctx.basicKeys = nil
+	ctx.sameSite = 0
+	ctx.streaming = false
+	ctx.params = nil
+	ctx.rawBody = nil
+	ctx.errs = nil
+	ctx.templateValues = nil
+	ctx.session = nil
+}
+
 // basic验证特有的"Authorization: Basic ${basic}"验证格式
 func (c *Context) SetBasicAuth(username, password string) {
 	c.R.Header.Set("Authorization", "Basic "+BasicAuth(username, password))
@@ -0,0 +1,278 @@
+package lora_router
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"github.com/LorraineWen/lorago/lora_render"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+/*
+*@Author: LorraineWen
+*csrf防护中间件，支持两种方式:
+*双重提交:随机的secret保存在cookie中，表单或者请求头中提交的token必须和cookie中的secret一致
+*cookie中的secret使用服务端的密钥进行HMAC签名，有会话时同时绑定session id，子域名等方式写入的伪造cookie无法通过验证
+*绑定的Session是新创建的时候会被标记为需要保存，保证下一次请求使用同一个session id验证签名
+*同步令牌:UseSession为true时secret保存在Session中，需要先使用会话中间件
+*每次请求输出的token都使用一次性的随机数进行掩码处理，防止BREACH攻击，验证时先去掉掩码，不接受没有掩码的secret
+*模板中通过{{csrfField}}输出隐藏表单字段，通过{{csrfToken}}获取token
+*GET，HEAD，OPTIONS，TRACE等安全的方法不需要验证，验证失败时返回403
+ */
+const (
+	csrfSecretLen           = 32
+	defaultCSRFCookieName   = "lora_csrf"
+	defaultCSRFHeaderName   = "X-CSRF-Token"
+	defaultCSRFFieldName    = "csrf_token"
+	csrfSessionKey          = "_csrf_secret"
+	defaultCSRFCookieMaxAge = 12 * 60 * 60
+)
+
+var defaultCSRFSafeMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace}
+
+type CSRFEntity struct {
+	UseSession   bool          //为true时使用同步令牌，secret保存在Session中
+	CookieName   string        //双重提交使用的cookie名称，为空时使用lora_csrf
+	CookieMaxAge int           //cookie的有效期(秒)，为0时使用12小时
+	Secure       bool          //cookie是否只通过https发送
+	SameSite     http.SameSite //为0时使用Lax
+	HeaderName   string        //提交token的请求头，为空时使用X-CSRF-Token
+	FieldName    string        //提交token的表单字段，为空时使用csrf_token
+	SafeMethods  []string      //不需要验证的请求方法，为空时使用GET，HEAD，OPTIONS，TRACE
+	ErrorFunc    HandleFunc    //验证失败的处理函数，为空时返回403
+	Key          []byte        //双重提交时签名cookie的密钥，为空时启动时随机生成，多个实例部署时需要设置相同的密钥
+	keyOnce      sync.Once
+	key          []byte
+}
+
+// 调用方式:
+//
+//	csrf := &lorago.CSRFEntity{Key: csrfKey, Secure: true}
+//	adminGroup.Use(csrf.CSRFMiddleware)
+//	//模板中:<form method="post">{{csrfField}}...</form>
+//	//ajax请求:请求头X-CSRF-Token设置为{{csrfToken}}
+//
+// UseSession为true时会话中间件需要在csrf中间件之前执行，后注册的中间件先执行
+// adminGroup.Use(csrf.CSRFMiddleware, session.SessionMiddleware)
+// 双重提交时如果会话中间件先执行，cookie会绑定Session，每个访客都会保存一个Session
+// 登录等操作重新生成session id之后secret也会重新生成
+func (c *CSRFEntity) CSRFMiddleware(next HandleFunc) HandleFunc {
+	return func(ctx *Context) {
+		secret, ok := c.loadSecret(ctx)
+		if !ok {
+			secret = newCSRFSecret()
+			c.saveSecret(ctx, secret)
+		}
+		ctx.SetTemplateValue(lora_render.CSRFTokenKey, maskCSRFToken(secret))
+		ctx.SetTemplateValue(lora_render.CSRFFieldNameKey, c.fieldName())
+		if c.isSafeMethod(ctx.R.Method) {
+			next(ctx)
+			return
+		}
+		token := ctx.R.Header.Get(c.headerName())
+		if token == "" {
+			token = ctx.GetFormQuery(c.fieldName())
+		}
+		if token == "" {
+			c.fail(ctx, "csrf token missing")
+			return
+		}
+		//cookie刚刚生成说明请求中没有secret，任何token都无法通过验证
+		if !ok || !validCSRFToken(secret, token) {
+			c.fail(ctx, "csrf token mismatch")
+			return
+		}
+		next(ctx)
+	}
+}
+
+// 获取当前请求的csrf token，用于在json响应中返回给前端
+func (ctx *Context) CSRFToken() string {
+	token, _ := ctx.templateValues[lora_render.CSRFTokenKey].(string)
+	return token
+}
+
+func (c *CSRFEntity) loadSecret(ctx *Context) ([]byte, bool) {
+	var value string
+	if c.UseSession {
+		session := ctx.Session()
+		if session == nil {
+			return nil, false
+		}
+		value, _ = stringValue(session.Get(csrfSessionKey))
+	} else {
+		cookie, err := ctx.R.Cookie(c.cookieName())
+		if err != nil {
+			return nil, false
+		}
+		return c.verifyCookie(ctx, cookie.Value)
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(secret) != csrfSecretLen {
+		return nil, false
+	}
+	return secret, true
+}
+
+// cookie的格式是base64(secret).base64(签名)
+func (c *CSRFEntity) verifyCookie(ctx *Context, value string) ([]byte, bool) {
+	encodedSecret, encodedSignature, found := strings.Cut(value, ".")
+	if !found {
+		return nil, false
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(encodedSecret)
+	if err != nil || len(secret) != csrfSecretLen {
+		return nil, false
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, c.sign(ctx, secret)) {
+		return nil, false
+	}
+	return secret, true
+}
+
+// 使用HMAC-SHA256对secret签名，有Session时把session id也加入签名
+// 生成和验证使用同一个规则，新的Session在saveSecret中标记为需要保存，id就是存储中保存的id
+func (c *CSRFEntity) sign(ctx *Context, secret []byte) []byte {
+	mac := hmac.New(sha256.New, c.signingKey())
+	if session := ctx.Session(); session != nil {
+		mac.Write([]byte(session.ID()))
+	}
+	mac.Write([]byte{0})
+	mac.Write(secret)
+	return mac.Sum(nil)
+}
+
+func (c *CSRFEntity) signingKey() []byte {
+	c.keyOnce.Do(func() {
+		c.key = c.Key
+		if len(c.key) == 0 {
+			c.key = newCSRFSecret()
+		}
+	})
+	return c.key
+}
+
+func stringValue(value any, ok bool) (string, bool) {
+	s, isString := value.(string)
+	return s, ok && isString
+}
+
+func (c *CSRFEntity) saveSecret(ctx *Context, secret []byte) {
+	value := base64.RawURLEncoding.EncodeToString(secret)
+	if c.UseSession {
+		if session := ctx.Session(); session != nil {
+			session.Set(csrfSessionKey, value)
+		} else {
+			ctx.AddError(errCSRFNoSession)
+		}
+		return
+	}
+	maxAge := c.CookieMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultCSRFCookieMaxAge
+	}
+	//新的Session没有写入数据时不会保存，下一次请求的session id会变化，签名也就无法通过验证
+	if session := ctx.Session(); session != nil && session.IsNew() {
+		session.Touch()
+	}
+	sameSite := c.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+	http.SetCookie(ctx.W, &http.Cookie{
+		Name:     c.cookieName(),
+		Value:    value + "." + base64.RawURLEncoding.EncodeToString(c.sign(ctx, secret)),
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   c.Secure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	})
+}
+
+func (c *CSRFEntity) fail(ctx *Context, reason string) {
+	if ctx.Logger != nil {
+		ctx.Logger.Info("request blocked: " + reason + " " + ctx.R.Method + " " + ctx.R.URL.Path)
+	}
+	if c.ErrorFunc != nil {
+		ctx.BasicSet("csrf_reason", reason)
+		c.ErrorFunc(ctx)
+		return
+	}
+	ctx.Fail(http.StatusForbidden, reason)
+}
+
+func (c *CSRFEntity) isSafeMethod(method string) bool {
+	methods := c.SafeMethods
+	if methods == nil {
+		methods = defaultCSRFSafeMethods
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CSRFEntity) cookieName() string {
+	if c.CookieName == "" {
+		return defaultCSRFCookieName
+	}
+	return c.CookieName
+}
+
+func (c *CSRFEntity) headerName() string {
+	if c.HeaderName == "" {
+		return defaultCSRFHeaderName
+	}
+	return c.HeaderName
+}
+
+func (c *CSRFEntity) fieldName() string {
+	if c.FieldName == "" {
+		return defaultCSRFFieldName
+	}
+	return c.FieldName
+}
+
+var errCSRFNoSession = errors.New("csrf middleware uses session but session middleware is not installed")
+
+func newCSRFSecret() []byte {
+	secret := make([]byte, csrfSecretLen)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// token由一次性的随机数和随机数与secret异或的结果组成，每次请求的token都不一样
+func maskCSRFToken(secret []byte) string {
+	pad := newCSRFSecret()
+	masked := make([]byte, csrfSecretLen*2)
+	copy(masked, pad)
+	for i := range secret {
+		masked[csrfSecretLen+i] = pad[i] ^ secret[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// 只接受掩码之后的token，去掉掩码之后和secret比较
+func validCSRFToken(secret []byte, token string) bool {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) != csrfSecretLen*2 {
+		return false
+	}
+	pad, masked := data[:csrfSecretLen], data[csrfSecretLen:]
+	unmasked := make([]byte, csrfSecretLen)
+	for i := range unmasked {
+		unmasked[i] = pad[i] ^ masked[i]
+	}
+	return subtle.ConstantTimeCompare(secret, unmasked) == 1
+}
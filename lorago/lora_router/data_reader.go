@@ -0,0 +1,176 @@
+package lora_router
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*支持从io.Reader和io.ReadSeeker返回数据，比如数据库中的文件和动态生成的压缩包
+*支持Range，If-Range和If-Modified-Since，设置了文件名称时会设置Content-Disposition
+*io.ReadSeeker交给http.ServeContent处理，支持多个范围
+*不能Seek的io.Reader只支持单个范围，通过丢弃前面的数据实现
+*数据不经过Render的缓冲区，边读取边写给客户端
+ */
+type DataOptions struct {
+	Filename string            //不为空时设置Content-Disposition
+	Inline   bool              //为true时浏览器直接打开，默认作为附件下载
+	ModTime  time.Time         //数据的修改时间，用于Last-Modified，If-Modified-Since和If-Range
+	Headers  map[string]string //额外的响应头
+}
+
+func (ctx *Context) writeDataHeaders(contentType string, options DataOptions) {
+	header := ctx.W.Header()
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	for key, value := range options.Headers {
+		header.Set(key, value)
+	}
+	if options.Filename != "" {
+		disposition := "attachment"
+		if options.Inline {
+			disposition = "inline"
+		}
+		ctx.setContentDisposition(disposition, options.Filename)
+	}
+}
+
+// 从io.ReadSeeker返回数据，contentType为空时根据文件名称或者内容推断
+// 调用方式:
+//
+//	blob := bytes.NewReader(data)
+//	context.DataFromReadSeeker("", blob, lorago.DataOptions{Filename: "报表.xlsx", ModTime: updatedAt})
+func (ctx *Context) DataFromReadSeeker(contentType string, content io.ReadSeeker, options DataOptions) {
+	ctx.writeDataHeaders(contentType, options)
+	w := NewStatusWriter(ctx.W)
+	http.ServeContent(w, ctx.R, options.Filename, options.ModTime, content)
+	ctx.StatusCode = w.Status
+}
+
+// 从不能Seek的io.Reader返回数据，contentLength小于0表示长度未知，这时不支持Range
+// 调用方式:
+//
+//	context.DataFromReader(http.StatusOK, resp.ContentLength, "application/zip", resp.Body, lorago.DataOptions{Filename: "archive.zip"})
+func (ctx *Context) DataFromReader(status int, contentLength int64, contentType string, reader io.Reader, options DataOptions) error {
+	ctx.writeDataHeaders(contentType, options)
+	header := ctx.W.Header()
+	if !options.ModTime.IsZero() {
+		header.Set("Last-Modified", options.ModTime.UTC().Format(http.TimeFormat))
+		if ctx.notModified(options.ModTime) {
+			header.Del("Content-Type")
+			header.Del("Content-Disposition")
+			ctx.W.WriteHeader(http.StatusNotModified)
+			ctx.StatusCode = http.StatusNotModified
+			return nil
+		}
+	}
+	if contentLength >= 0 {
+		header.Set("Accept-Ranges", "bytes")
+		if rangeHeader := ctx.R.Header.Get("Range"); rangeHeader != "" && ctx.ifRangeMatch(options.ModTime) {
+			start, length, ok, satisfiable := parseSingleRange(rangeHeader, contentLength)
+			if !satisfiable {
+				header.Set("Content-Range", fmt.Sprintf("bytes */%d", contentLength))
+				ctx.W.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				ctx.StatusCode = http.StatusRequestedRangeNotSatisfiable
+				return nil
+			}
+			if ok {
+				if _, err := io.CopyN(io.Discard, reader, start); err != nil {
+					return err
+				}
+				header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, contentLength))
+				contentLength = length
+				status = http.StatusPartialContent
+			}
+		}
+		header.Set("Content-Length", strconv.FormatInt(contentLength, 10))
+	}
+	ctx.W.WriteHeader(status)
+	ctx.StatusCode = status
+	if ctx.R.Method == http.MethodHead {
+		return nil
+	}
+	if contentLength >= 0 {
+		_, err := io.CopyN(ctx.W, reader, contentLength)
+		return err
+	}
+	_, err := io.Copy(ctx.W, reader)
+	return err
+}
+
+// 判断If-Modified-Since，时间精确到秒
+func (ctx *Context) notModified(modTime time.Time) bool {
+	if ctx.R.Method != http.MethodGet && ctx.R.Method != http.MethodHead {
+		return false
+	}
+	since, err := http.ParseTime(ctx.R.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(since)
+}
+
+// 没有If-Range或者If-Range的时间和修改时间一致时才处理Range，否则返回完整的数据
+func (ctx *Context) ifRangeMatch(modTime time.Time) bool {
+	ifRange := ctx.R.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	//没有ETag，所以If-Range是ETag时认为数据已经变化
+	t, err := http.ParseTime(ifRange)
+	if err != nil || modTime.IsZero() {
+		return false
+	}
+	return modTime.Truncate(time.Second).Equal(t)
+}
+
+// 解析只有一个范围的Range，ok为false表示忽略Range返回完整的数据，satisfiable为false表示返回416
+func parseSingleRange(rangeHeader string, size int64) (start, length int64, ok, satisfiable bool) {
+	spec, found := strings.CutPrefix(rangeHeader, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, true
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, true
+	}
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+	if first == "" {
+		//-n表示最后n个字节
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return 0, 0, false, true
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, true
+	}
+	if start >= size {
+		return 0, 0, false, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, true
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true, true
+}
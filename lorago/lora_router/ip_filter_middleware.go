@@ -0,0 +1,287 @@
+package lora_router
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"github.com/LorraineWen/lorago/lora_conf"
+	"github.com/LorraineWen/lorago/lora_log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*ip访问控制中间件，根据客户端ip判断是否允许访问，客户端ip通过ClientIP获取
+*先检查拒绝列表，再检查允许列表，允许列表为空时允许所有没有被拒绝的ip
+*设置了CountryLookup时支持按照国家代码控制访问，比如只允许"CN"
+*规则可以写在toml文件中，文件修改之后会自动重新加载，也可以从配置文件的[ip_filter]中读取
+*被拦截的请求会记录日志和拦截原因
+*通过unix socket部署在反向代理后面时需要调用engine.SetTrustUnixSocket(true)，否则没有客户端ip，所有请求都会被拦截
+ */
+const defaultIPFilterReloadInterval = 10 * time.Second
+
+// 根据ip查询国家代码，lora_geoip.MaxMindDB实现了该接口
+type CountryLookup interface {
+	Country(ip net.IP) (string, error)
+}
+
+// 规则文件的格式
+// allow = ["10.0.0.0/8", "192.168.1.0/24"]
+// deny = ["10.0.0.13"]
+// allow_countries = ["CN"]
+// deny_countries = []
+type IPFilterRules struct {
+	Allow          []string `toml:"allow"`
+	Deny           []string `toml:"deny"`
+	AllowCountries []string `toml:"allow_countries"`
+	DenyCountries  []string `toml:"deny_countries"`
+}
+
+type IPFilterEntity struct {
+	Rules          IPFilterRules
+	File           string        //规则文件，不为空时使用文件中的规则
+	ReloadInterval time.Duration //检查规则文件是否修改的间隔，为0时使用10秒
+	Countries      CountryLookup //为空时国家代码的规则不生效
+	BlockedFunc    HandleFunc    //拦截之后的处理函数，为空时返回403
+	compiled       atomic.Pointer[compiledIPRules]
+	modTime        time.Time
+	lastCheck      atomic.Int64
+	reloadLock     sync.Mutex
+	initOnce       sync.Once
+	loadErr        error //最近一次加载失败的原因，规则还没有加载成功时用于拦截原因
+}
+
+type compiledIPRules struct {
+	allow          []*net.IPNet
+	deny           []*net.IPNet
+	allowCountries map[string]bool
+	denyCountries  map[string]bool
+}
+
+// 从配置文件的[ip_filter]中创建，支持allow，deny，allow_countries，deny_countries和file
+// [ip_filter]
+// file = "conf/ip_filter.toml"
+// allow = ["10.0.0.0/8"]
+func NewIPFilterByConf() *IPFilterEntity {
+	conf := lora_conf.Load().IpFilter
+	filter := &IPFilterEntity{Rules: IPFilterRules{
+		Allow:          confStrings(conf["allow"]),
+		Deny:           confStrings(conf["deny"]),
+		AllowCountries: confStrings(conf["allow_countries"]),
+		DenyCountries:  confStrings(conf["deny_countries"]),
+	}}
+	if file, ok := conf["file"].(string); ok {
+		filter.File = file
+	}
+	return filter
+}
+
+// 调用方式:
+//
+//	filter := &lorago.IPFilterEntity{Rules: lorago.IPFilterRules{Allow: []string{"10.0.0.0/8"}}}
+//	adminGroup.Use(filter.IPFilterMiddleware)
+func (f *IPFilterEntity) IPFilterMiddleware(next HandleFunc) HandleFunc {
+	f.initOnce.Do(func() {
+		f.Reload()
+	})
+	return func(ctx *Context) {
+		//第一次加载失败之后也会每隔ReloadInterval重试，比如规则文件在服务启动之后才部署
+		f.reloadIfChanged(ctx.Logger)
+		if f.compiled.Load() == nil {
+			//规则加载成功之前拒绝所有请求，避免管理后台被意外暴露
+			f.block(ctx, "ip filter rules not loaded: "+f.lastLoadErr())
+			return
+		}
+		if reason, blocked := f.check(ctx.ClientIP()); blocked {
+			f.block(ctx, reason)
+			return
+		}
+		next(ctx)
+	}
+}
+
+// 重新加载规则，设置了File时从文件中读取，加载失败时继续使用旧的规则
+func (f *IPFilterEntity) Reload() error {
+	f.reloadLock.Lock()
+	defer f.reloadLock.Unlock()
+	f.loadErr = f.load()
+	return f.loadErr
+}
+
+func (f *IPFilterEntity) lastLoadErr() string {
+	f.reloadLock.Lock()
+	defer f.reloadLock.Unlock()
+	if f.loadErr == nil {
+		return "unknown error"
+	}
+	return f.loadErr.Error()
+}
+
+func (f *IPFilterEntity) load() error {
+	rules := f.Rules
+	if f.File != "" {
+		info, err := os.Stat(f.File)
+		if err != nil {
+			return err
+		}
+		rules = IPFilterRules{}
+		if _, err = toml.DecodeFile(f.File, &rules); err != nil {
+			return err
+		}
+		f.modTime = info.ModTime()
+	}
+	compiled, err := compileIPRules(rules)
+	if err != nil {
+		return err
+	}
+	f.compiled.Store(compiled)
+	f.lastCheck.Store(time.Now().UnixNano())
+	return nil
+}
+
+// 每隔ReloadInterval检查一次规则文件的修改时间，规则还没有加载成功时重新加载
+func (f *IPFilterEntity) reloadIfChanged(logger *lora_log.Logger) {
+	if f.File == "" && f.compiled.Load() != nil {
+		return
+	}
+	interval := f.ReloadInterval
+	if interval <= 0 {
+		interval = defaultIPFilterReloadInterval
+	}
+	last := f.lastCheck.Load()
+	now := time.Now().UnixNano()
+	if now-last < int64(interval) || !f.lastCheck.CompareAndSwap(last, now) {
+		return
+	}
+	if f.compiled.Load() == nil {
+		if err := f.Reload(); err != nil {
+			logIPFilter(logger, "load ip filter rules failed: "+err.Error())
+			return
+		}
+		logIPFilter(logger, "ip filter rules loaded")
+		return
+	}
+	info, err := os.Stat(f.File)
+	if err != nil {
+		logIPFilter(logger, "stat ip filter file failed: "+err.Error())
+		return
+	}
+	f.reloadLock.Lock()
+	changed := !info.ModTime().Equal(f.modTime)
+	f.reloadLock.Unlock()
+	if !changed {
+		return
+	}
+	if err = f.Reload(); err != nil {
+		logIPFilter(logger, "reload ip filter file failed: "+err.Error())
+		return
+	}
+	logIPFilter(logger, "ip filter rules reloaded from "+f.File)
+}
+
+func compileIPRules(rules IPFilterRules) (*compiledIPRules, error) {
+	compiled := &compiledIPRules{
+		allowCountries: countrySet(rules.AllowCountries),
+		denyCountries:  countrySet(rules.DenyCountries),
+	}
+	for _, cidr := range rules.Allow {
+		ipNet, err := parseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		compiled.allow = append(compiled.allow, ipNet)
+	}
+	for _, cidr := range rules.Deny {
+		ipNet, err := parseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		compiled.deny = append(compiled.deny, ipNet)
+	}
+	return compiled, nil
+}
+
+func countrySet(countries []string) map[string]bool {
+	set := make(map[string]bool, len(countries))
+	for _, country := range countries {
+		set[strings.ToUpper(strings.TrimSpace(country))] = true
+	}
+	return set
+}
+
+func matchIPNet(list []*net.IPNet, ip net.IP) (*net.IPNet, bool) {
+	for _, ipNet := range list {
+		if ipNet.Contains(ip) {
+			return ipNet, true
+		}
+	}
+	return nil, false
+}
+
+// 判断ip是否被拦截，返回拦截的原因
+func (f *IPFilterEntity) check(clientIP string) (string, bool) {
+	rules := f.compiled.Load()
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return fmt.Sprintf("invalid client ip [%s]", clientIP), true
+	}
+	if ipNet, ok := matchIPNet(rules.deny, ip); ok {
+		return fmt.Sprintf("ip %s matches deny rule %s", clientIP, ipNet), true
+	}
+	country, countryErr := f.country(ip, rules)
+	if country != "" && rules.denyCountries[country] {
+		return fmt.Sprintf("ip %s from denied country %s", clientIP, country), true
+	}
+	if len(rules.allow) == 0 && len(rules.allowCountries) == 0 {
+		return "", false
+	}
+	if _, ok := matchIPNet(rules.allow, ip); ok {
+		return "", false
+	}
+	if country != "" && rules.allowCountries[country] {
+		return "", false
+	}
+	if countryErr != nil && len(rules.allowCountries) > 0 {
+		return fmt.Sprintf("ip %s not in allow list, country lookup failed: %v", clientIP, countryErr), true
+	}
+	return fmt.Sprintf("ip %s not in allow list", clientIP), true
+}
+
+// 只有配置了国家代码的规则时才查询
+func (f *IPFilterEntity) country(ip net.IP, rules *compiledIPRules) (string, error) {
+	if len(rules.allowCountries) == 0 && len(rules.denyCountries) == 0 {
+		return "", nil
+	}
+	if f.Countries == nil {
+		return "", errors.New("country lookup is not configured")
+	}
+	country, err := f.Countries.Country(ip)
+	return strings.ToUpper(country), err
+}
+
+func (f *IPFilterEntity) block(ctx *Context, reason string) {
+	logger := ctx.Logger
+	if logger != nil {
+		logger = logger.WithFields(lora_log.Fields{"path": ctx.R.URL.Path, "ip": ctx.ClientIP()})
+	}
+	logIPFilter(logger, "request blocked: "+reason)
+	if f.BlockedFunc != nil {
+		ctx.BasicSet("ip_filter_reason", reason)
+		f.BlockedFunc(ctx)
+		return
+	}
+	ctx.Fail(http.StatusForbidden, http.StatusText(http.StatusForbidden))
+}
+
+func logIPFilter(logger *lora_log.Logger, msg string) {
+	if logger == nil {
+		return
+	}
+	logger.Info(msg)
+}
@@ -35,7 +35,8 @@ type LogFormatterParams struct {
 	ClientIP   net.IP
 	Method     string
 	Path       string
-	isColorful bool //设置是否需要颜色，在控制台输出可以设置为true，如果是将日志输出到文件中，就要变为false,否则就会将颜色字符也写到文件里面
+	Errors     []error //处理请求过程中产生的错误，比如渲染失败
+	isColorful bool    //设置是否需要颜色，在控制台输出可以设置为true，如果是将日志输出到文件中，就要变为false,否则就会将颜色字符也写到文件里面
 }
 
 // 支持日志颜色
@@ -70,6 +71,17 @@ func (p *LogFormatterParams) ResetColor() string {
 	return reset
 }
 
+// 每个错误单独一行输出，没有错误时返回空字符串
+func (p *LogFormatterParams) ErrorMessage() string {
+	var sb strings.Builder
+	for _, err := range p.Errors {
+		sb.WriteString("Error: ")
+		sb.WriteString(err.Error())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
 var defaultLogFormatter = func(params LogFormatterParams) string {
 	statusCodeColor := params.StatusCodeColor()
 	resetColor := params.ResetColor()
@@ -78,19 +90,21 @@ var defaultLogFormatter = func(params LogFormatterParams) string {
 	}
 	//启用颜色
 	if params.isColorful {
-		return fmt.Sprintf("%s [lorago] %s |%s %v %s| %s %3d %s |%s %13v %s| %15s  |%s %-7s %s %s %#v %s\n",
+		return fmt.Sprintf("%s [lorago] %s |%s %v %s| %s %3d %s |%s %13v %s| %15s  |%s %-7s %s %s %#v %s\n%s",
 			yellow, resetColor, blue, params.TimeStamp.Format("2006/01/02 - 15:04:05"), resetColor,
 			statusCodeColor, params.StatusCode, resetColor,
 			red, params.Latency, resetColor,
 			params.ClientIP,
 			magenta, params.Method, resetColor,
 			cyan, params.Path, resetColor,
+			params.ErrorMessage(),
 		)
 	} else {
-		return fmt.Sprintf("[msgo] %v | %3d | %13v | %15s |%-7s %#v",
+		return fmt.Sprintf("[msgo] %v | %3d | %13v | %15s |%-7s %#v\n%s",
 			params.TimeStamp.Format("2006/01/02 - 15:04:05"),
 			params.StatusCode,
 			params.Latency, params.ClientIP, params.Method, params.Path,
+			params.ErrorMessage(),
 		)
 	}
 
@@ -123,8 +137,7 @@ func LoggerWithConfig(conf LoggerConfig, next HandleFunc) HandleFunc {
 		// stop timer
 		stop := time.Now()
 		latency := stop.Sub(start)
-		ip, _, _ := net.SplitHostPort(strings.TrimSpace(ctx.R.RemoteAddr))
-		clientIP := net.ParseIP(ip)
+		clientIP := net.ParseIP(ctx.ClientIP())
 		method := ctx.R.Method
 		statusCode := ctx.StatusCode
 
@@ -138,6 +151,7 @@ func LoggerWithConfig(conf LoggerConfig, next HandleFunc) HandleFunc {
 		param.StatusCode = statusCode
 		param.Method = method
 		param.Path = path
+		param.Errors = ctx.Errors()
 		param.isColorful = isColor
 		fmt.Fprint(out, formatter(param))
 	}
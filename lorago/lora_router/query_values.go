@@ -0,0 +1,371 @@
+package lora_router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*请求参数和表单参数的类型转换，支持int，bool，float64，time.Time和对应的切片
+*GetXxx返回转换错误，参数不存在时返回ErrMissingParam，DefaultXxx在参数不存在或者转换失败时返回默认值
+*支持将user[address][city]这种多层的参数解析为map[string]any
+ */
+var ErrMissingParam = errors.New("param not found")
+
+// 参数转换失败，实现了StatusCode，交给engine的errHandler时返回400
+type ParamError struct {
+	Key   string
+	Value string
+	Err   error
+}
+
+func (e *ParamError) Error() string {
+	if errors.Is(e.Err, ErrMissingParam) {
+		return fmt.Sprintf("param [%s] not found", e.Key)
+	}
+	return fmt.Sprintf("param [%s] value %q is invalid: %v", e.Key, e.Value, e.Err)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ParamError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+func getParam[T any](values url.Values, key string, parse func(string) (T, error)) (T, error) {
+	var zero T
+	list, ok := values[key]
+	if !ok || len(list) == 0 {
+		return zero, &ParamError{Key: key, Err: ErrMissingParam}
+	}
+	v, err := parse(list[0])
+	if err != nil {
+		return zero, &ParamError{Key: key, Value: list[0], Err: err}
+	}
+	return v, nil
+}
+
+func getParamSlice[T any](values url.Values, key string, parse func(string) (T, error)) ([]T, error) {
+	list, ok := values[key]
+	if !ok || len(list) == 0 {
+		return nil, &ParamError{Key: key, Err: ErrMissingParam}
+	}
+	ret := make([]T, 0, len(list))
+	for _, item := range list {
+		v, err := parse(item)
+		if err != nil {
+			return nil, &ParamError{Key: key, Value: item, Err: err}
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+func defaultParam[T any](v T, err error, defaultValue T) T {
+	if err != nil {
+		return defaultValue
+	}
+	return v
+}
+
+func parseBool(value string) (bool, error) {
+	//复选框没有value时浏览器会提交on
+	if value == "on" {
+		return true, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func parseFloat(value string) (float64, error) {
+	return strconv.ParseFloat(value, 64)
+}
+
+// layout为空时使用RFC3339，unix和unixnano表示时间戳，和绑定时的time_format标签一致
+func timeParser(layout string) func(string) (time.Time, error) {
+	return func(value string) (time.Time, error) {
+		switch layout {
+		case "":
+			return time.Parse(time.RFC3339, value)
+		case "unix", "unixnano":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if layout == "unixnano" {
+				return time.Unix(0, n), nil
+			}
+			return time.Unix(n, 0), nil
+		default:
+			return time.ParseInLocation(layout, value, time.Local)
+		}
+	}
+}
+
+// 将prefix开头的多层参数解析为map，user[address][city]=x解析为{"address": {"city": "x"}}
+// user[tags][]=a&user[tags][]=b解析为{"tags": ["a", "b"]}，一个key对应多个值时也解析为[]string
+// prefix为空时解析所有的参数
+func nestedMap(values url.Values, prefix string) (map[string]any, bool) {
+	ret := make(map[string]any)
+	exist := false
+	for key, list := range values {
+		path, ok := splitNestedKey(key)
+		if !ok {
+			continue
+		}
+		if prefix != "" {
+			if path[0] != prefix || len(path) < 2 {
+				continue
+			}
+			path = path[1:]
+		}
+		exist = true
+		setNested(ret, path, list)
+	}
+	return ret, exist
+}
+
+// 将user[address][city]拆分为["user", "address", "city"]，user[tags][]拆分为["user", "tags", ""]
+func splitNestedKey(key string) ([]string, bool) {
+	index := strings.IndexByte(key, '[')
+	if index < 0 {
+		return []string{key}, key != ""
+	}
+	if index == 0 {
+		return nil, false
+	}
+	path := []string{key[:index]}
+	rest := key[index:]
+	for rest != "" {
+		if rest[0] != '[' {
+			return nil, false
+		}
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return nil, false
+		}
+		path = append(path, rest[1:end])
+		rest = rest[end+1:]
+	}
+	return path, true
+}
+
+func setNested(m map[string]any, path []string, list []string) {
+	for i, name := range path {
+		last := i == len(path)-1
+		//user[tags][]
+		isSlice := !last && path[i+1] == "" && i+1 == len(path)-1
+		if _, isMap := m[name].(map[string]any); isMap && (last || isSlice) {
+			//user[a][b]=1和user[a]=2或者user[a][]=2同时存在时保留多层的参数，结果和参数的顺序无关
+			return
+		}
+		if isSlice {
+			m[name] = append([]string(nil), list...)
+			return
+		}
+		if last {
+			if len(list) == 1 {
+				m[name] = list[0]
+			} else {
+				m[name] = append([]string(nil), list...)
+			}
+			return
+		}
+		child, ok := m[name].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			m[name] = child
+		}
+		m = child
+	}
+}
+
+// 获取int类型的请求参数，/list?page=2
+// 调用方式:page, err := context.GetQueryInt("page")
+func (ctx *Context) GetQueryInt(key string) (int, error) {
+	ctx.initQueryCache()
+	return getParam(ctx.queryCache, key, strconv.Atoi)
+}
+
+func (ctx *Context) GetQueryBool(key string) (bool, error) {
+	ctx.initQueryCache()
+	return getParam(ctx.queryCache, key, parseBool)
+}
+
+func (ctx *Context) GetQueryFloat(key string) (float64, error) {
+	ctx.initQueryCache()
+	return getParam(ctx.queryCache, key, parseFloat)
+}
+
+// layout为空时使用RFC3339，也可以是unix和unixnano
+// 调用方式:since, err := context.GetQueryTime("since", "2006-01-02")
+func (ctx *Context) GetQueryTime(key, layout string) (time.Time, error) {
+	ctx.initQueryCache()
+	return getParam(ctx.queryCache, key, timeParser(layout))
+}
+
+// 获取多个int类型的请求参数，/list?id=1&id=2
+// 调用方式:ids, err := context.GetQueryIntSlice("id")
+func (ctx *Context) GetQueryIntSlice(key string) ([]int, error) {
+	ctx.initQueryCache()
+	return getParamSlice(ctx.queryCache, key, strconv.Atoi)
+}
+
+func (ctx *Context) GetQueryBoolSlice(key string) ([]bool, error) {
+	ctx.initQueryCache()
+	return getParamSlice(ctx.queryCache, key, parseBool)
+}
+
+func (ctx *Context) GetQueryFloatSlice(key string) ([]float64, error) {
+	ctx.initQueryCache()
+	return getParamSlice(ctx.queryCache, key, parseFloat)
+}
+
+func (ctx *Context) GetQueryTimeSlice(key, layout string) ([]time.Time, error) {
+	ctx.initQueryCache()
+	return getParamSlice(ctx.queryCache, key, timeParser(layout))
+}
+
+// 调用方式:page := context.DefaultQueryInt("page", 1)
+func (ctx *Context) DefaultQueryInt(key string, defaultValue int) int {
+	v, err := ctx.GetQueryInt(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultQueryBool(key string, defaultValue bool) bool {
+	v, err := ctx.GetQueryBool(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultQueryFloat(key string, defaultValue float64) float64 {
+	v, err := ctx.GetQueryFloat(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultQueryTime(key, layout string, defaultValue time.Time) time.Time {
+	v, err := ctx.GetQueryTime(key, layout)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultQueryIntSlice(key string, defaultValue []int) []int {
+	v, err := ctx.GetQueryIntSlice(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultQueryBoolSlice(key string, defaultValue []bool) []bool {
+	v, err := ctx.GetQueryBoolSlice(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultQueryFloatSlice(key string, defaultValue []float64) []float64 {
+	v, err := ctx.GetQueryFloatSlice(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultQueryTimeSlice(key, layout string, defaultValue []time.Time) []time.Time {
+	v, err := ctx.GetQueryTimeSlice(key, layout)
+	return defaultParam(v, err, defaultValue)
+}
+
+// 获取多层的map格式请求参数，/adduser?user[name]=amie&user[address][city]=beijing
+// 返回{"name": "amie", "address": {"city": "beijing"}}
+// 调用方式:user, ok := context.GetQueryNestedMap("user")
+func (ctx *Context) GetQueryNestedMap(key string) (map[string]any, bool) {
+	ctx.initQueryCache()
+	return nestedMap(ctx.queryCache, key)
+}
+
+// 以下是表单参数的类型转换，和请求参数的用法一致
+// 调用方式:age, err := context.GetFormQueryInt("age")
+func (ctx *Context) GetFormQueryInt(key string) (int, error) {
+	ctx.initFormCache()
+	return getParam(ctx.formCache, key, strconv.Atoi)
+}
+
+func (ctx *Context) GetFormQueryBool(key string) (bool, error) {
+	ctx.initFormCache()
+	return getParam(ctx.formCache, key, parseBool)
+}
+
+func (ctx *Context) GetFormQueryFloat(key string) (float64, error) {
+	ctx.initFormCache()
+	return getParam(ctx.formCache, key, parseFloat)
+}
+
+func (ctx *Context) GetFormQueryTime(key, layout string) (time.Time, error) {
+	ctx.initFormCache()
+	return getParam(ctx.formCache, key, timeParser(layout))
+}
+
+func (ctx *Context) GetFormQueryIntSlice(key string) ([]int, error) {
+	ctx.initFormCache()
+	return getParamSlice(ctx.formCache, key, strconv.Atoi)
+}
+
+func (ctx *Context) GetFormQueryBoolSlice(key string) ([]bool, error) {
+	ctx.initFormCache()
+	return getParamSlice(ctx.formCache, key, parseBool)
+}
+
+func (ctx *Context) GetFormQueryFloatSlice(key string) ([]float64, error) {
+	ctx.initFormCache()
+	return getParamSlice(ctx.formCache, key, parseFloat)
+}
+
+func (ctx *Context) GetFormQueryTimeSlice(key, layout string) ([]time.Time, error) {
+	ctx.initFormCache()
+	return getParamSlice(ctx.formCache, key, timeParser(layout))
+}
+
+func (ctx *Context) DefaultFormQueryInt(key string, defaultValue int) int {
+	v, err := ctx.GetFormQueryInt(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultFormQueryBool(key string, defaultValue bool) bool {
+	v, err := ctx.GetFormQueryBool(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultFormQueryFloat(key string, defaultValue float64) float64 {
+	v, err := ctx.GetFormQueryFloat(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultFormQueryTime(key, layout string, defaultValue time.Time) time.Time {
+	v, err := ctx.GetFormQueryTime(key, layout)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultFormQueryIntSlice(key string, defaultValue []int) []int {
+	v, err := ctx.GetFormQueryIntSlice(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultFormQueryBoolSlice(key string, defaultValue []bool) []bool {
+	v, err := ctx.GetFormQueryBoolSlice(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultFormQueryFloatSlice(key string, defaultValue []float64) []float64 {
+	v, err := ctx.GetFormQueryFloatSlice(key)
+	return defaultParam(v, err, defaultValue)
+}
+
+func (ctx *Context) DefaultFormQueryTimeSlice(key, layout string, defaultValue []time.Time) []time.Time {
+	v, err := ctx.GetFormQueryTimeSlice(key, layout)
+	return defaultParam(v, err, defaultValue)
+}
+
+// 调用方式:user, ok := context.GetFormQueryNestedMap("user")
+func (ctx *Context) GetFormQueryNestedMap(key string) (map[string]any, bool) {
+	ctx.initFormCache()
+	return nestedMap(ctx.formCache, key)
+}
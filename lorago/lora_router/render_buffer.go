@@ -0,0 +1,84 @@
+package lora_router
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+)
+
+/*
+*@Author: LorraineWen
+*渲染响应时先把状态码和响应体写入缓冲区，渲染成功之后再一次性写给客户端
+*避免编码失败时客户端收到200和不完整的响应体
+*响应体超过缓冲区大小之后直接写给客户端，大的json响应不会全部放到内存中
+ */
+// 默认的缓冲区大小，超过该大小的缓冲区也不放回池中，避免偶尔的大响应长期占用内存
+const defaultRenderBufferSize = 64 << 10
+
+var renderBufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// 响应头直接使用原始ResponseWriter的响应头，状态码和响应体暂存在缓冲区中
+type renderBuffer struct {
+	w         http.ResponseWriter
+	status    int
+	body      *bytes.Buffer
+	limit     int  //缓冲区的最大字节数，小于0表示不缓冲
+	streaming bool //已经超过了缓冲区大小，之后的数据直接写给客户端
+}
+
+func newRenderBuffer(w http.ResponseWriter, limit int) *renderBuffer {
+	body := renderBufferPool.Get().(*bytes.Buffer)
+	body.Reset()
+	return &renderBuffer{w: w, status: http.StatusOK, body: body, limit: limit}
+}
+
+func (b *renderBuffer) Header() http.Header {
+	return b.w.Header()
+}
+
+func (b *renderBuffer) WriteHeader(status int) {
+	if b.streaming {
+		return
+	}
+	b.status = status
+	if b.limit < 0 {
+		b.flushTo()
+	}
+}
+
+func (b *renderBuffer) Write(data []byte) (int, error) {
+	if !b.streaming && b.body.Len()+len(data) > b.limit {
+		if err := b.flushTo(); err != nil {
+			return 0, err
+		}
+	}
+	if b.streaming {
+		return b.w.Write(data)
+	}
+	return b.body.Write(data)
+}
+
+// 将缓冲的响应写给客户端，之后的数据不再经过缓冲区
+func (b *renderBuffer) flushTo() error {
+	if b.streaming {
+		return nil
+	}
+	b.streaming = true
+	b.w.WriteHeader(b.status)
+	if b.body.Len() == 0 {
+		return nil
+	}
+	_, err := b.w.Write(b.body.Bytes())
+	return err
+}
+
+func (b *renderBuffer) release() {
+	if b.body.Cap() <= defaultRenderBufferSize {
+		renderBufferPool.Put(b.body)
+	}
+	b.body = nil
+}
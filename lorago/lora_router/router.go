@@ -1,13 +1,16 @@
 package lora_router
 
 import (
+	"errors"
 	"fmt"
+	"github.com/LorraineWen/lorago/lora_bind"
 	"github.com/LorraineWen/lorago/lora_conf"
 	"github.com/LorraineWen/lorago/lora_log"
 	"github.com/LorraineWen/lorago/lora_render"
 	"github.com/LorraineWen/lorago/lora_util"
 	"html/template"
 	"log"
+	"net"
 	"net/http"
 	"sync"
 )
@@ -150,17 +153,28 @@ func (r *routerGroup) MiddlewareHandleFunc(ctx *Context, name, method string, ha
 // 这里是直接嵌入了类型，所以Engine继承了router的方法和成员
 type Engine struct {
 	*router
-	funcMap         template.FuncMap               //设置html模板渲染时所需要的函数
-	htmlRender      lora_render.HtmlTemplateRender //在内存中存放html模板
-	pool            sync.Pool                      //存放context对象，避免context对象的多次重复创建，导致多次重复释放内存和分配内存
-	Logger          *lora_log.Logger               //初始化context里面的日志对象
-	MiddlewareFuncs []MiddlewareFunc               //初始化的处理器的时候就需要注册的中间件
-	errHandler      ErrorHandler                   //支持code和status
+	funcMap            template.FuncMap         //设置html模板渲染时所需要的函数
+	htmlRender         lora_render.HTMLRenderer //模板引擎，默认使用html/template
+	pool               sync.Pool                //存放context对象，避免context对象的多次重复创建，导致多次重复释放内存和分配内存
+	Logger             *lora_log.Logger         //初始化context里面的日志对象
+	MiddlewareFuncs    []MiddlewareFunc         //初始化的处理器的时候就需要注册的中间件
+	errHandler         ErrorHandler             //支持code和status
+	serverOptions      ServerOptions            //http服务器的参数，支持h2c和http2参数配置
+	maxBodySize        int64                    //请求体的最大字节数，0表示不限制
+	maxMultipartMemory int64                    //解析multipart表单时最多加载到内存中的大小
+	negotiateDefault   string                   //内容协商都不匹配时使用的媒体类型
+	debugMode          bool                     //调试模式下json响应会缩进输出
+	secureJsonPrefix   string                   //安全json的前缀，为空时使用while(1);
+	jsonpCallbackKey   string                   //jsonp回调函数名称对应的请求参数，为空时使用callback
+	trustedProxies     []*net.IPNet             //可信的代理，只有来自可信代理的请求才读取X-Forwarded-For等请求头
+	remoteIPHeaders    []string                 //读取客户端ip的请求头，为空时使用X-Forwarded-For和X-Real-IP
+	trustUnixSocket    bool                     //信任通过unix domain socket连接的对端
+	renderBufferSize   int                      //渲染响应时缓冲区的最大字节数，超过之后直接写给客户端
 }
 
 // 直接初始化引擎
 func New() *Engine {
-	engine := &Engine{router: &router{}, funcMap: nil, htmlRender: lora_render.HtmlTemplateRender{}, Logger: lora_log.NewLogger()}
+	engine := &Engine{router: &router{}, funcMap: nil, htmlRender: &lora_render.HtmlTemplateRender{}, Logger: lora_log.NewLogger(), errHandler: DefaultErrorHandler}
 	engine.pool.New = func() any {
 
 		return engine.allocateContext()
@@ -173,7 +187,7 @@ func New() *Engine {
 // 通过配置文件初始化引擎
 func Default() *Engine {
 	engine := New()
-	logPath, ok := lora_conf.TomlConf.Log["path"]
+	logPath, ok := lora_conf.Load().Log["path"]
 	if ok {
 		engine.Logger.SetLogPath(logPath.(string))
 	}
@@ -189,14 +203,86 @@ func (e *Engine) allocateContext() any {
 	return &Context{engine: e}
 }
 
+// 设置所有请求的请求体最大字节数，超过时返回413，单个路由可以通过BodyLimitMiddleware修改
+func (e *Engine) SetMaxBodySize(n int64) {
+	e.maxBodySize = n
+}
+
+// 设置解析multipart表单时最多加载到内存中的大小，超过的部分会存放到临时文件中
+func (e *Engine) SetMaxMultipartMemory(n int64) {
+	e.maxMultipartMemory = n
+}
+
+// 设置内容协商都不匹配时使用的媒体类型，比如lora_render.MIMEJSON，不设置时返回406
+func (e *Engine) SetNegotiateDefault(mediaType string) {
+	e.negotiateDefault = mediaType
+}
+
+// 设置渲染响应时缓冲区的最大字节数，为0时使用64KB，小于0时不使用缓冲区
+// 缓冲区中的响应渲染失败时可以返回500，超过缓冲区大小之后直接写给客户端，渲染失败只能记录到日志中
+func (e *Engine) SetRenderBufferSize(n int) {
+	e.renderBufferSize = n
+}
+
+// 设置调试模式，调试模式下JsonResponseWrite会输出缩进的json
+func (e *Engine) SetDebugMode(debug bool) {
+	e.debugMode = debug
+}
+
+// 设置安全json的前缀
+func (e *Engine) SetSecureJsonPrefix(prefix string) {
+	e.secureJsonPrefix = prefix
+}
+
+// 设置jsonp回调函数名称对应的请求参数，比如"cb"
+func (e *Engine) SetJsonpCallbackKey(key string) {
+	e.jsonpCallbackKey = key
+}
+
 // 以下三个函数都是在渲染html模板时，需要调用的函数
-// 通过配置文件加载模板
+// 通过配置文件加载模板，pattern可以是一个glob或者多个glob，配置了layouts时使用LoadTemplates加载
+// [template]
+// pattern = ["templates/pages/*.html", "templates/admin/*.html"]
+// layouts = ["templates/layouts/*.html"]
 func (e *Engine) LoadTemplateGlobByConf() {
-	pattern, ok := lora_conf.TomlConf.Template["pattern"]
+	conf := lora_conf.Load().Template
+	pattern, ok := conf["pattern"]
 	if !ok {
 		panic("config pattern not exist")
 	}
-	e.LoadTemplate(pattern.(string))
+	if p, isString := pattern.(string); isString {
+		if _, hasLayouts := conf["layouts"]; !hasLayouts {
+			e.LoadTemplate(p)
+			return
+		}
+	}
+	source := lora_render.TemplateSource{
+		Layouts: confStrings(conf["layouts"]),
+		Pages:   confStrings(pattern),
+	}
+	if err := e.LoadTemplates(lora_render.TemplateOptions{Sources: []lora_render.TemplateSource{source}}); err != nil {
+		panic(err)
+	}
+}
+
+// 配置文件中的值可以是字符串或者字符串数组
+func confStrings(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		ret := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				ret = append(ret, s)
+			}
+		}
+		return ret
+	default:
+		return nil
+	}
 }
 
 // 设置html需要的一些函数
@@ -207,17 +293,51 @@ func (e *Engine) SetFuncMap(funcMap template.FuncMap) {
 // 将html模板加载到内存中
 // 调用方式:engine.LoadTemplate("../test/template/*.html")
 func (e *Engine) LoadTemplate(pattern string) {
-	t := template.Must(template.New("").Funcs(e.funcMap).ParseGlob(pattern))
-	e.htmlRender = lora_render.HtmlTemplateRender{Template: t}
+	t := template.Must(template.New("").Funcs(lora_render.ContextFuncMap(nil)).Funcs(e.funcMap).ParseGlob(pattern))
+	e.htmlRender = lora_render.NewHtmlTemplateRender(t)
+}
+
+// 替换TemplateResponseWrite使用的模板引擎
+// 调用方式:engine.SetHTMLRenderer(&lora_render.TextTemplateRender{Template: mailTemplate})
+func (e *Engine) SetHTMLRenderer(renderer lora_render.HTMLRenderer) {
+	e.htmlRender = renderer
+}
+
+// 从多个目录或者embed.FS中加载带布局的模板，没有设置FuncMap时使用SetFuncMap设置的函数
+// 调试模式下会开启模板的开发模式，模板文件变化时自动重新解析
+// 调用方式:
+//
+//	engine.LoadTemplates(lora_render.TemplateOptions{Sources: []lora_render.TemplateSource{
+//		{Layouts: []string{"templates/layouts/*.html"}, Pages: []string{"templates/pages/*.html"}},
+//	}})
+func (e *Engine) LoadTemplates(options lora_render.TemplateOptions) error {
+	if options.FuncMap == nil {
+		options.FuncMap = e.funcMap
+	}
+	options.Dev = options.Dev || e.debugMode
+	set, err := lora_render.NewTemplateSet(options)
+	if err != nil {
+		return err
+	}
+	e.htmlRender = &lora_render.HtmlTemplateRender{Set: set}
+	return nil
 }
 
 // Engine需要实现ServeHTTP函数，才能实现Hanler接口，Engine才能成为一个自定义的路由处理器
 func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	method := r.Method
 	ctx := e.pool.Get().(*Context)
-	ctx.W = w
-	ctx.R = r
+	ctx.reset(w, r)
+	defer func() {
+		//放回pool之前去掉对请求的引用
+		ctx.reset(nil, nil)
+		e.pool.Put(ctx)
+	}()
 	ctx.Logger = e.Logger
+	ctx.rawBody = r.Body
+	if e.maxBodySize > 0 {
+		ctx.SetMaxBodySize(e.maxBodySize)
+	}
 	for _, group := range e.routerGroups {
 		//判断请求中的URL里面是否包含分组路径
 		routerName := lora_util.SubStringLast(r.URL.Path, "/"+group.groupName) //如果url中包含分组路径，那么就返回url中分组路径后面的请求路径，/user/getname，返回/getname
@@ -225,9 +345,11 @@ func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		//对于/user/getname/1,routerName=/getname/1
 		//node.routerName=/get/name/:id，这也是我们实际注册的路由，所应该应该使用node.routerName来索引得到处理routerName的函数
 		if node != nil && node.isEnd {
+			ctx.params = parseParams(node.routerName, routerName)
 			handle, ok := group.handlerMap[node.routerName][ANY]
 			if ok {
-				group.MiddlewareHandleFunc(ctx, node.routerName, method, handle)
+				//Any注册的路由中间件存放在ANY下面，不能使用请求的方法去查找
+				group.MiddlewareHandleFunc(ctx, node.routerName, ANY, handle)
 				return
 			}
 			handle, ok = group.handlerMap[node.routerName][method]
@@ -248,7 +370,11 @@ func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 // 开启https验证
 func (e *Engine) RunTLS(addr, certFile, keyFile string) {
-	err := http.ListenAndServeTLS(addr, certFile, keyFile, e)
+	server, err := e.NewServer(addr)
+	if err != nil {
+		log.Fatal("ListenAndServeTLS: ", err)
+	}
+	err = server.ListenAndServeTLS(certFile, keyFile)
 	if err != nil {
 		log.Fatal("ListenAndServeTLS: ", err)
 	}
@@ -256,12 +382,40 @@ func (e *Engine) RunTLS(addr, certFile, keyFile string) {
 
 type ErrorHandler func(err error) (int, any)
 
+// 默认的错误处理函数，校验失败返回422和每个属性的错误信息，带有状态码的错误返回对应的状态码，其余返回500
+func DefaultErrorHandler(err error) (int, any) {
+	var validationErrors lora_bind.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		return validationErrors.StatusCode(), map[string]any{
+			"code":   validationErrors.StatusCode(),
+			"msg":    "validation failed",
+			"errors": validationErrors,
+		}
+	}
+	status := http.StatusInternalServerError
+	if IsBodyTooLarge(err) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	var statusError interface{ StatusCode() int }
+	if errors.As(err, &statusError) {
+		status = statusError.StatusCode()
+	}
+	return status, map[string]any{
+		"code": status,
+		"msg":  err.Error(),
+	}
+}
+
 func (e *Engine) RegisterErrorHandler(err ErrorHandler) {
 	e.errHandler = err
 }
 func (e *Engine) Run() {
 	//e是一个自定义的路由处理器
-	err := http.ListenAndServe(":8080", e)
+	server, err := e.NewServer(":8080")
+	if err != nil {
+		panic(err)
+	}
+	err = server.ListenAndServe()
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,127 @@
+package lora_router
+
+import (
+	"crypto/tls"
+	"errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*该文件主要负责http服务器的创建
+*支持不使用tls的http2(h2c)，方便内部的gRPC-web之类的客户端直接访问
+*支持配置http2的参数，比如最大并发流数量
+*支持自定义监听器，比如unix domain socket，方便以sidecar的方式部署
+*Handler()返回的处理器可以直接交给http3服务器使用
+ */
+type ServerOptions struct {
+	H2C               bool          //是否启用h2c
+	ReadTimeout       time.Duration //读取整个请求的超时时间
+	ReadHeaderTimeout time.Duration //读取请求头的超时时间
+	WriteTimeout      time.Duration //写入响应的超时时间
+	IdleTimeout       time.Duration //keep-alive连接的空闲超时时间
+	MaxHeaderBytes    int           //请求头的最大字节数
+	Http2             Http2Options
+}
+
+// http2的参数，为0的参数使用http2库的默认值
+type Http2Options struct {
+	MaxConcurrentStreams         uint32        //每个连接的最大并发流数量
+	MaxReadFrameSize             uint32        //读取帧的最大字节数
+	MaxUploadBufferPerConnection int32         //每个连接的流量控制窗口大小
+	MaxUploadBufferPerStream     int32         //每个流的流量控制窗口大小
+	IdleTimeout                  time.Duration //空闲连接的超时时间
+	ReadIdleTimeout              time.Duration //超过该时间没有收到帧就发送ping进行健康检查
+	PingTimeout                  time.Duration //ping的超时时间
+}
+
+// 设置服务器参数，需要在Run之前调用
+// 调用方式:engine.SetServerOptions(lorago.ServerOptions{H2C: true, Http2: lorago.Http2Options{MaxConcurrentStreams: 250}})
+func (e *Engine) SetServerOptions(options ServerOptions) {
+	e.serverOptions = options
+}
+
+// 启用h2c，不使用tls也可以使用http2
+func (e *Engine) EnableH2C() {
+	e.serverOptions.H2C = true
+}
+
+func (e *Engine) http2Server() *http2.Server {
+	options := e.serverOptions.Http2
+	return &http2.Server{
+		MaxConcurrentStreams:         options.MaxConcurrentStreams,
+		MaxReadFrameSize:             options.MaxReadFrameSize,
+		MaxUploadBufferPerConnection: options.MaxUploadBufferPerConnection,
+		MaxUploadBufferPerStream:     options.MaxUploadBufferPerStream,
+		IdleTimeout:                  options.IdleTimeout,
+		ReadIdleTimeout:              options.ReadIdleTimeout,
+		PingTimeout:                  options.PingTimeout,
+	}
+}
+
+// 返回处理请求的处理器，启用h2c时会包装一层h2c处理器
+// 可以用于http3等自定义服务器:http3.Server{Handler: engine.Handler()}
+func (e *Engine) Handler() http.Handler {
+	if e.serverOptions.H2C {
+		return h2c.NewHandler(e, e.http2Server())
+	}
+	return e
+}
+
+// 根据服务器参数创建http服务器
+func (e *Engine) NewServer(addr string) (*http.Server, error) {
+	return e.newServer(addr, nil)
+}
+
+func (e *Engine) newServer(addr string, tlsConfig *tls.Config) (*http.Server, error) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           e.Handler(),
+		TLSConfig:         tlsConfig,
+		ReadTimeout:       e.serverOptions.ReadTimeout,
+		ReadHeaderTimeout: e.serverOptions.ReadHeaderTimeout,
+		WriteTimeout:      e.serverOptions.WriteTimeout,
+		IdleTimeout:       e.serverOptions.IdleTimeout,
+		MaxHeaderBytes:    e.serverOptions.MaxHeaderBytes,
+	}
+	//使用tls时，http2的参数通过ConfigureServer生效
+	if err := http2.ConfigureServer(server, e.http2Server()); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// 使用自定义的监听器启动服务器
+// 调用方式:
+// listener, _ := net.Listen("unix", "/tmp/lorago.sock")
+// engine.RunListener(listener)
+func (e *Engine) RunListener(listener net.Listener) error {
+	server, err := e.NewServer(listener.Addr().String())
+	if err != nil {
+		return err
+	}
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// 使用unix domain socket启动服务器，如果socket文件已经存在会先删除
+// unix socket的RemoteAddr是@或者空字符串，没有对端的ip，需要通过engine.SetTrustUnixSocket(true)从代理设置的请求头中获取客户端的ip
+func (e *Engine) RunUnix(file string) error {
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	listener, err := net.Listen("unix", file)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+	return e.RunListener(listener)
+}
@@ -0,0 +1,92 @@
+package lora_router
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/LorraineWen/lorago/lora_session"
+	"net"
+	"net/http"
+	"sync"
+)
+
+/*
+*@Author: LorraineWen
+*会话中间件，请求开始时加载Session，在写入响应头之前保存Session并设置cookie
+*处理函数中通过context.Session()获取当前请求的Session
+ */
+type SessionEntity struct {
+	Store lora_session.Store
+}
+
+// 调用方式:
+//
+//	store, _ := lora_session.NewCookieStore(lora_session.Options{Secure: true}, key)
+//	session := &lorago.SessionEntity{Store: store}
+//	adminGroup.Use(session.SessionMiddleware)
+func (s *SessionEntity) SessionMiddleware(next HandleFunc) HandleFunc {
+	return func(ctx *Context) {
+		session, err := s.Store.Load(ctx.R)
+		if err != nil && ctx.Logger != nil {
+			//cookie被篡改或者存储不可用时使用新的Session
+			ctx.Logger.Info("load session failed: " + err.Error())
+		}
+		ctx.session = session
+		w := ctx.W
+		sw := &sessionWriter{ResponseWriter: w}
+		sw.save = func() {
+			//保存失败时响应照常返回，比如cookie超过4096字节，需要在日志中看到原因
+			if err := s.Store.Save(w, session); err != nil {
+				ctx.AddError(fmt.Errorf("save session failed: %w", err))
+				if ctx.Logger != nil {
+					ctx.Logger.Error("save session failed: " + err.Error())
+				}
+			}
+		}
+		ctx.W = sw
+		next(ctx)
+		ctx.W = w
+		//处理函数没有写入任何响应时也需要保存
+		sw.saveOnce()
+	}
+}
+
+// 获取当前请求的Session，没有使用会话中间件时返回nil
+func (ctx *Context) Session() *lora_session.Session {
+	return ctx.session
+}
+
+// 第一次写入响应头之前保存Session
+type sessionWriter struct {
+	http.ResponseWriter
+	save func()
+	once sync.Once
+}
+
+func (w *sessionWriter) saveOnce() {
+	w.once.Do(w.save)
+}
+
+func (w *sessionWriter) WriteHeader(status int) {
+	w.saveOnce()
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *sessionWriter) Write(data []byte) (int, error) {
+	w.saveOnce()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *sessionWriter) Flush() {
+	w.saveOnce()
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// websocket等协议升级时接管连接之前先保存Session，之后写入的响应头不会再发送
+func (w *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.saveOnce()
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+func (w *sessionWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,31 @@
+package lora_router
+
+import "net/http"
+
+/*
+*@Author: LorraineWen
+*把响应交给http.ServeContent或者httputil.ReverseProxy等标准库处理时，记录最终写入的状态码
+*通过Unwrap可以找到原始的ResponseWriter，http.ResponseController的Flush等操作不受影响
+ */
+type StatusWriter struct {
+	http.ResponseWriter
+	Status int //没有调用WriteHeader时是200
+}
+
+// 调用方式:
+//
+//	w := lora_router.NewStatusWriter(ctx.W)
+//	handler.ServeHTTP(w, ctx.R)
+//	ctx.StatusCode = w.Status
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w, Status: http.StatusOK}
+}
+
+func (w *StatusWriter) WriteHeader(status int) {
+	w.Status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *StatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
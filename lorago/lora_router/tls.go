@@ -0,0 +1,224 @@
+package lora_router
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*支持证书热加载的https服务器，证书续期之后不需要重启进程
+*定时检查证书和私钥文件的修改时间，发生变化就重新加载，通过tls.Config.GetCertificate原子地替换证书
+*支持多个SNI证书，支持设置最低tls版本和加密套件
+*支持启动一个http监听，将http请求重定向到https，使用308保留请求方法和请求体
+ */
+const defaultReloadInterval = time.Minute
+
+type TLSOptions struct {
+	Certificates   []CertKeyPair //证书列表，根据客户端的SNI选择证书，都不匹配时使用第一个
+	MinVersion     uint16        //最低tls版本，为0时使用tls.VersionTLS12
+	CipherSuites   []uint16      //加密套件，为空时使用go的默认值，tls1.3不支持配置
+	ReloadInterval time.Duration //检查证书文件是否变化的时间间隔，为0时使用1分钟
+	RedirectAddr   string        //http重定向监听地址，比如":80"，为空则不启动
+}
+
+type CertKeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// 负责加载和热更新证书，GetCertificate可以直接用于自定义的tls.Config
+// 调用方式:
+//
+//	reloader, err := lorago.NewCertReloader([]lorago.CertKeyPair{{CertFile: "a.crt", KeyFile: "a.key"}})
+//	go reloader.Watch(time.Minute, stop)
+//	tlsConfig := &tls.Config{GetCertificate: reloader.GetCertificate}
+type CertReloader struct {
+	pairs    []CertKeyPair
+	certs    atomic.Pointer[[]*tls.Certificate]
+	modTimes []time.Time
+	lock     sync.Mutex //Watch和手动调用Reload可能同时进行，保护modTimes
+}
+
+func NewCertReloader(pairs []CertKeyPair) (*CertReloader, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("tls certificates is empty")
+	}
+	reloader := &CertReloader{pairs: pairs}
+	if _, err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// 重新加载所有证书，只要有一个证书加载失败就继续使用旧的证书
+// 证书文件没有变化时不会重新加载，返回值表示是否加载了新的证书
+func (c *CertReloader) Reload() (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	modTimes := make([]time.Time, 0, len(c.pairs))
+	for _, pair := range c.pairs {
+		modTime, err := latestModTime(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return false, err
+		}
+		modTimes = append(modTimes, modTime)
+	}
+	if c.modTimes != nil && equalTimes(c.modTimes, modTimes) {
+		return false, nil
+	}
+	certs := make([]*tls.Certificate, 0, len(c.pairs))
+	for _, pair := range c.pairs {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return false, err
+		}
+		if cert.Leaf == nil {
+			cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+			if err != nil {
+				return false, err
+			}
+		}
+		certs = append(certs, &cert)
+	}
+	c.certs.Store(&certs)
+	c.modTimes = modTimes
+	return true, nil
+}
+
+// 定时检查证书文件，直到stop被关闭
+func (c *CertReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			reloaded, err := c.Reload()
+			if err != nil {
+				log.Println("reload tls certificate failed:", err)
+				continue
+			}
+			if reloaded {
+				log.Println("tls certificate reloaded")
+			}
+		}
+	}
+}
+
+// 根据客户端的SNI选择证书，都不匹配时使用第一个
+func (c *CertReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certs := *c.certs.Load()
+	for _, cert := range certs {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	return certs[0], nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// 开启https验证，并且支持证书热加载
+// 调用方式:
+//
+//	engine.RunTLSWithOptions(":443", lorago.TLSOptions{
+//		Certificates: []lorago.CertKeyPair{{CertFile: "a.crt", KeyFile: "a.key"}},
+//		RedirectAddr: ":80",
+//	})
+func (e *Engine) RunTLSWithOptions(addr string, options TLSOptions) error {
+	reloader, err := NewCertReloader(options.Certificates)
+	if err != nil {
+		return err
+	}
+	minVersion := options.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   options.CipherSuites,
+		GetCertificate: reloader.GetCertificate,
+	}
+	server, err := e.newServer(addr, tlsConfig)
+	if err != nil {
+		return err
+	}
+	interval := options.ReloadInterval
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(stop)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		reloader.Watch(interval, stop)
+	}()
+	if options.RedirectAddr != "" {
+		redirectServer := &http.Server{Addr: options.RedirectAddr, Handler: HTTPSRedirectHandler(addr)}
+		defer redirectServer.Close()
+		go func() {
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Println("https redirect server:", err)
+			}
+		}()
+	}
+	err = server.ListenAndServeTLS("", "")
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// 将http请求重定向到https，如果https不是443端口，需要在重定向地址中带上端口
+// 使用308而不是301，POST等请求重定向之后不会被客户端改成GET
+// 调用方式:http.ListenAndServe(":80", lorago.HTTPSRedirectHandler(":443"))
+func HTTPSRedirectHandler(tlsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -11,8 +11,8 @@ import "strings"
 type trieNode struct {
 	name       string      //节点名称(user,order,get)
 	children   []*trieNode //前缀树的子节点
-	routerName string
-	isEnd      bool //是否遍历到根节点，避免一种情况，如果注册了/user/hello/amie，那么访问/user/hello同样有效(返回405，而不是404)，但是我们并没有注册/user/hello
+	routerName string      //从根节点到当前节点注册的完整路径，put的时候确定，get只读取，可以并发查找
+	isEnd      bool        //是否遍历到根节点，避免一种情况，如果注册了/user/hello/amie，那么访问/user/hello同样有效(返回405，而不是404)，但是我们并没有注册/user/hello
 }
 
 // 负责放入路径
@@ -38,7 +38,7 @@ func (t *trieNode) put(name string) {
 			if index == len(strs)-1 {
 				isEnd = true
 			}
-			child := &trieNode{name: path, children: make([]*trieNode, 0), isEnd: isEnd}
+			child := &trieNode{name: path, children: make([]*trieNode, 0), routerName: t.routerName + "/" + path, isEnd: isEnd}
 			children = append(children, child)
 			t.children = children
 			t = child
@@ -50,7 +50,6 @@ func (t *trieNode) put(name string) {
 // 负责拿出路径，返回group后面的完整路径，是/getname/:id，而不是/getname/1或者/getname/2
 func (t *trieNode) get(name string) *trieNode {
 	strs := strings.Split(name, "/")
-	routerName := ""
 	for index, path := range strs {
 		if index == 0 {
 			continue
@@ -60,8 +59,6 @@ func (t *trieNode) get(name string) *trieNode {
 		for _, child := range children {
 			if child.name == path || child.name == "*" || strings.Contains(child.name, ":") { //如果同时注册:id和*类型的路由，那么就会出问题
 				isMatch = true
-				routerName += "/" + child.name
-				child.routerName = routerName
 				t = child
 				if index == len(strs)-1 {
 					return child
@@ -72,8 +69,6 @@ func (t *trieNode) get(name string) *trieNode {
 		if !isMatch {
 			for _, child := range children {
 				if child.name == "**" {
-					routerName += "/" + child.name
-					child.routerName = routerName
 					return child
 				}
 			}
@@ -81,3 +76,19 @@ func (t *trieNode) get(name string) *trieNode {
 	}
 	return nil
 }
+
+// 根据注册的路由和请求路径解析路由参数，/get/:id和/get/1解析出id=1
+func parseParams(routerName, path string) map[string]string {
+	params := make(map[string]string)
+	names := strings.Split(routerName, "/")
+	values := strings.Split(path, "/")
+	for index, name := range names {
+		if index >= len(values) {
+			break
+		}
+		if strings.HasPrefix(name, ":") {
+			params[name[1:]] = values[index]
+		}
+	}
+	return params
+}
@@ -0,0 +1,127 @@
+package lora_session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*将Session的数据保存在cookie中，使用AES-GCM加密，GCM的认证标签同时起到签名的作用，被篡改的cookie无法解密
+*支持多个密钥轮换，第一个密钥用于加密，所有密钥都可以用于解密
+ */
+const maxCookieSize = 4096
+
+var ErrCookieTooLarge = errors.New("session cookie exceeds 4096 bytes")
+
+type CookieStore struct {
+	options Options
+	aeads   []cipher.AEAD
+}
+
+// 密钥长度必须是16，24或者32字节
+// 调用方式:store, err := lora_session.NewCookieStore(lora_session.Options{Secure: true}, key)
+func NewCookieStore(options Options, keys ...[]byte) (*CookieStore, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("cookie store needs at least one key")
+	}
+	options.setDefaults()
+	store := &CookieStore{options: options}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		store.aeads = append(store.aeads, aead)
+	}
+	return store, nil
+}
+
+func (c *CookieStore) Load(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(c.options.CookieName)
+	if err != nil {
+		return newSession(), nil
+	}
+	data, err := c.decrypt(cookie.Value)
+	if err != nil {
+		return staleSession(), err
+	}
+	rec, err := decodeRecord(data)
+	if err != nil {
+		return staleSession(), err
+	}
+	if c.options.expired(rec, time.Now()) {
+		return staleSession(), nil
+	}
+	if rec.Values == nil {
+		rec.Values = make(map[string]any)
+	}
+	return &Session{record: *rec}, nil
+}
+
+func (c *CookieStore) Save(w http.ResponseWriter, s *Session) error {
+	if s.destroyed {
+		http.SetCookie(w, c.options.cookie("", 0))
+		return nil
+	}
+	if !s.needSave() {
+		if s.stale {
+			http.SetCookie(w, c.options.cookie("", 0))
+		}
+		return nil
+	}
+	now := time.Now()
+	rec := s.snapshot(now)
+	data, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	value, err := c.encrypt(data)
+	if err != nil {
+		return err
+	}
+	cookie := c.options.cookie(value, c.options.ttl(rec.Created, now))
+	if len(cookie.String()) > maxCookieSize {
+		return ErrCookieTooLarge
+	}
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// cookie名称作为附加数据，防止把一个cookie的值复制到另一个cookie中使用
+func (c *CookieStore) encrypt(data []byte) (string, error) {
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, data, []byte(c.options.CookieName))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (c *CookieStore) decrypt(value string) ([]byte, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, aead := range c.aeads {
+		if len(sealed) < aead.NonceSize() {
+			continue
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if data, err := aead.Open(nil, nonce, ciphertext, []byte(c.options.CookieName)); err == nil {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid session cookie")
+}
@@ -0,0 +1,179 @@
+package lora_session
+
+import (
+	"github.com/LorraineWen/lorago/lora_cache"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*将Session的数据保存在服务端，cookie中只保存随机生成的session id
+*ServerStore是服务端存储的接口，默认提供内存中的实现，也可以实现该接口接入redis等外部存储
+ */
+type ServerStore interface {
+	Get(id string) ([]byte, bool, error)
+	Set(id string, data []byte, ttl time.Duration) error
+	Delete(id string) error
+}
+
+type ServerSideStore struct {
+	options Options
+	store   ServerStore
+}
+
+// 调用方式:store := lora_session.NewServerSideStore(lora_session.Options{}, lora_session.NewMemoryStore())
+func NewServerSideStore(options Options, store ServerStore) *ServerSideStore {
+	options.setDefaults()
+	return &ServerSideStore{options: options, store: store}
+}
+
+func (s *ServerSideStore) Load(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(s.options.CookieName)
+	if err != nil || cookie.Value == "" {
+		return newSession(), nil
+	}
+	data, ok, err := s.store.Get(cookie.Value)
+	if err != nil {
+		//存储不可用时不删除cookie，存储恢复之后还可以继续使用
+		return newSession(), err
+	}
+	if !ok {
+		return staleSession(), nil
+	}
+	rec, err := decodeRecord(data)
+	if err != nil {
+		return staleSession(), err
+	}
+	//存储中的id和cookie中的id不一致时说明数据有问题
+	if rec.ID != cookie.Value || s.options.expired(rec, time.Now()) {
+		s.store.Delete(cookie.Value)
+		return staleSession(), nil
+	}
+	if rec.Values == nil {
+		rec.Values = make(map[string]any)
+	}
+	return &Session{record: *rec}, nil
+}
+
+func (s *ServerSideStore) Save(w http.ResponseWriter, session *Session) error {
+	if session.oldID != "" {
+		if err := s.store.Delete(session.oldID); err != nil {
+			return err
+		}
+	}
+	if session.destroyed {
+		if !session.isNew {
+			if err := s.store.Delete(session.ID()); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, s.options.cookie("", 0))
+		return nil
+	}
+	if !session.needSave() {
+		if session.stale {
+			http.SetCookie(w, s.options.cookie("", 0))
+		}
+		return nil
+	}
+	now := time.Now()
+	rec := session.snapshot(now)
+	data, err := encodeRecord(rec)
+	if err != nil {
+		return err
+	}
+	ttl := s.options.ttl(rec.Created, now)
+	if err = s.store.Set(rec.ID, data, ttl); err != nil {
+		return err
+	}
+	http.SetCookie(w, s.options.cookie(rec.ID, ttl))
+	return nil
+}
+
+// 内存中的服务端存储，过期的数据在读取时删除，每隔一段时间清理一次
+type MemoryStore struct {
+	items     map[string]memoryItem
+	lock      sync.Mutex
+	lastClean time.Time
+}
+
+type memoryItem struct {
+	data     []byte
+	expireAt time.Time
+}
+
+const memoryStoreCleanInterval = time.Minute
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{items: make(map[string]memoryItem), lastClean: time.Now()}
+}
+
+func (m *MemoryStore) Get(id string) ([]byte, bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.items[id]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(item.expireAt) {
+		delete(m.items, id)
+		return nil, false, nil
+	}
+	return item.data, true, nil
+}
+
+func (m *MemoryStore) Set(id string, data []byte, ttl time.Duration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	if now.Sub(m.lastClean) > memoryStoreCleanInterval {
+		for key, item := range m.items {
+			if now.After(item.expireAt) {
+				delete(m.items, key)
+			}
+		}
+		m.lastClean = now
+	}
+	m.items[id] = memoryItem{data: data, expireAt: now.Add(ttl)}
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.items, id)
+	return nil
+}
+
+func (m *MemoryStore) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.items)
+}
+
+// 使用lora_cache.Cache作为服务端存储，注意LRU缓存满了之后会淘汰Session
+// 调用方式:lora_session.NewCacheStore(lora_cache.NewLRUCache(10000))
+func NewCacheStore(cache lora_cache.Cache) ServerStore {
+	return cacheStore{cache: cache}
+}
+
+type cacheStore struct {
+	cache lora_cache.Cache
+}
+
+func (c cacheStore) Get(id string) ([]byte, bool, error) {
+	data, ok := c.cache.Get(id)
+	return data, ok, nil
+}
+
+func (c cacheStore) Set(id string, data []byte, ttl time.Duration) error {
+	c.cache.Set(id, data, ttl)
+	return nil
+}
+
+func (c cacheStore) Delete(id string) error {
+	c.cache.Delete(id)
+	return nil
+}
@@ -0,0 +1,257 @@
+package lora_session
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+*@Author: LorraineWen
+*会话管理，Session保存在cookie中(加密并签名)或者服务端的存储中，cookie中只保存session id
+*支持空闲超时和绝对超时，超时之后会创建新的Session
+*支持闪存消息，读取一次之后自动删除，适合服务端渲染的页面在重定向之后显示提示信息
+*自定义类型的值需要先调用gob.Register注册
+ */
+const (
+	defaultCookieName      = "lora_session"
+	defaultIdleTimeout     = 30 * time.Minute
+	defaultAbsoluteTimeout = 12 * time.Hour
+)
+
+type Options struct {
+	CookieName      string //为空时使用lora_session
+	Path            string //为空时使用/
+	Domain          string
+	Secure          bool
+	AllowScript     bool          //为true时允许js读取cookie，默认HttpOnly
+	SameSite        http.SameSite //为0时使用Lax
+	IdleTimeout     time.Duration //超过该时间没有访问就失效，为0时使用30分钟
+	AbsoluteTimeout time.Duration //创建之后超过该时间就失效，为0时使用12小时
+}
+
+func (o *Options) setDefaults() {
+	if o.CookieName == "" {
+		o.CookieName = defaultCookieName
+	}
+	if o.Path == "" {
+		o.Path = "/"
+	}
+	if o.SameSite == 0 {
+		o.SameSite = http.SameSiteLaxMode
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = defaultIdleTimeout
+	}
+	if o.AbsoluteTimeout <= 0 {
+		o.AbsoluteTimeout = defaultAbsoluteTimeout
+	}
+}
+
+// 距离失效还有多长时间，取空闲超时和绝对超时中较早的一个
+func (o *Options) ttl(created, now time.Time) time.Duration {
+	ttl := o.IdleTimeout
+	if remain := created.Add(o.AbsoluteTimeout).Sub(now); remain < ttl {
+		ttl = remain
+	}
+	return ttl
+}
+
+func (o *Options) expired(r *record, now time.Time) bool {
+	return now.Sub(r.LastAccess) > o.IdleTimeout || now.Sub(r.Created) > o.AbsoluteTimeout
+}
+
+func (o *Options) cookie(value string, maxAge time.Duration) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     o.CookieName,
+		Value:    value,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		Secure:   o.Secure,
+		HttpOnly: !o.AllowScript,
+		SameSite: o.SameSite,
+	}
+	if maxAge <= 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(maxAge / time.Second)
+		cookie.Expires = time.Now().Add(maxAge)
+	}
+	return cookie
+}
+
+// 加载和保存Session，CookieStore和ServerSideStore实现了该接口
+type Store interface {
+	//读取请求中的Session，不存在，无法解析或者已经超时时返回新的Session
+	Load(r *http.Request) (*Session, error)
+	//保存Session并写入cookie，必须在写入响应头之前调用
+	Save(w http.ResponseWriter, s *Session) error
+}
+
+// 需要持久化的数据
+type record struct {
+	ID         string
+	Values     map[string]any
+	Flashes    []any
+	Created    time.Time
+	LastAccess time.Time
+}
+
+func encodeRecord(r *record) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeRecord(data []byte) (*record, error) {
+	r := &record{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+type Session struct {
+	record    record
+	oldID     string //调用RegenerateID之前的id，保存时从服务端存储中删除
+	isNew     bool
+	modified  bool
+	destroyed bool
+	stale     bool //请求中的cookie已经失效，没有写入新的数据时保存时删除cookie
+	lock      sync.Mutex
+}
+
+func newSession() *Session {
+	now := time.Now()
+	return &Session{
+		record: record{ID: newID(), Values: make(map[string]any), Created: now, LastAccess: now},
+		isNew:  true,
+	}
+}
+
+// cookie超时，被篡改或者对应的数据已经不存在时使用，避免浏览器一直带着失效的cookie
+func staleSession() *Session {
+	s := newSession()
+	s.stale = true
+	return s
+}
+
+func newID() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (s *Session) ID() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.record.ID
+}
+
+// 是否是这次请求新创建的Session
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+// 调用方式:userID, ok := context.Session().Get("user_id")
+func (s *Session) Get(key string) (any, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	value, ok := s.record.Values[key]
+	return value, ok
+}
+
+// 调用方式:context.Session().Set("user_id", 1)
+func (s *Session) Set(key string, value any) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.record.Values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.record.Values, key)
+	s.modified = true
+}
+
+// 清空所有的值
+func (s *Session) Clear() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.record.Values = make(map[string]any)
+	s.record.Flashes = nil
+	s.modified = true
+}
+
+// 添加闪存消息，下一次读取之后删除
+// 调用方式:context.Session().AddFlash("保存成功")
+func (s *Session) AddFlash(value any) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.record.Flashes = append(s.record.Flashes, value)
+	s.modified = true
+}
+
+// 读取并删除所有的闪存消息
+func (s *Session) Flashes() []any {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	flashes := s.record.Flashes
+	if len(flashes) > 0 {
+		s.record.Flashes = nil
+		s.modified = true
+	}
+	return flashes
+}
+
+// 重新生成session id，登录成功或者权限变化之后调用，防止会话固定攻击
+func (s *Session) RegenerateID() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.record.ID
+	}
+	s.record.ID = newID()
+	s.modified = true
+}
+
+// 标记Session需要保存，新的Session没有写入数据时也会保存，id在下一次请求中保持不变
+// 调用方式:context.Session().Touch()
+func (s *Session) Touch() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.modified = true
+}
+
+// 销毁Session，保存时删除cookie和服务端存储中的数据，退出登录时调用
+func (s *Session) Destroy() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.destroyed = true
+	s.record.Values = make(map[string]any)
+	s.record.Flashes = nil
+}
+
+// 新的Session没有写入任何数据时不需要保存，避免给每个访客都设置cookie
+func (s *Session) needSave() bool {
+	return !s.isNew || s.modified
+}
+
+// 复制一份需要持久化的数据，并更新最后访问时间
+func (s *Session) snapshot(now time.Time) *record {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.record.LastAccess = now
+	r := s.record
+	return &r
+}
@@ -0,0 +1,108 @@
+package lora_upload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+*@Author: LorraineWen
+*上传文件的存储接口，默认提供本地目录的实现，也可以实现该接口接入oss，s3等对象存储
+ */
+type Storage interface {
+	//保存文件，返回文件的访问位置，本地存储返回文件路径，对象存储可以返回url
+	Save(ctx context.Context, key string, r io.Reader, info FileInfo) (string, error)
+	//删除文件，批量上传失败时删除已经保存的文件
+	Delete(ctx context.Context, key string) error
+}
+
+// 保存时已知的文件信息，哈希值要读完之后才能得到，所以不在这里
+type FileInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// 保存到本地目录，key是相对于Dir的路径
+// 调用方式:storage := &lora_upload.LocalStorage{Dir: "./uploads"}
+type LocalStorage struct {
+	Dir      string
+	DirPerm  os.FileMode //为0时使用0755
+	FilePerm os.FileMode //为0时使用0644
+}
+
+var ErrInvalidKey = errors.New("invalid upload key")
+
+// 将key转换为Dir下面的路径，不允许通过..跳出Dir
+func (s *LocalStorage) path(key string) (string, error) {
+	root, err := filepath.Abs(s.Dir)
+	if err != nil {
+		return "", err
+	}
+	dst := filepath.Join(root, filepath.FromSlash(key))
+	if dst == root || !strings.HasPrefix(dst, root+string(filepath.Separator)) {
+		return "", ErrInvalidKey
+	}
+	return dst, nil
+}
+
+// 先写入临时文件，写完之后再重命名，避免留下不完整的文件
+func (s *LocalStorage) Save(ctx context.Context, key string, r io.Reader, info FileInfo) (string, error) {
+	dst, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	dirPerm, filePerm := s.DirPerm, s.FilePerm
+	if dirPerm == 0 {
+		dirPerm = 0755
+	}
+	if filePerm == 0 {
+		filePerm = 0644
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), dirPerm); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, contextReader{ctx: ctx, r: r}); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	if err = os.Chmod(tmp.Name(), filePerm); err != nil {
+		return "", err
+	}
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	dst, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(dst)
+}
+
+// 请求取消之后停止写入
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,277 @@
+package lora_upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+*@Author: LorraineWen
+*上传文件处理，支持为每个表单字段设置最大大小和允许的文件类型
+*文件类型通过文件内容的前512个字节判断，不信任客户端传递的Content-Type
+*保存时边读边计算哈希值，文件名称会去掉路径和特殊字符
+ */
+const sniffLen = 512
+
+type Rule struct {
+	MaxSize      int64    //单个文件的最大字节数，0表示不限制
+	AllowedTypes []string //允许的文件类型，比如"image/png"，"image/*"，为空表示不限制
+	MaxFiles     int      //同一个字段最多的文件数量，0表示不限制
+}
+
+// 调用方式:
+//
+//	uploader := &lora_upload.Uploader{
+//		Storage: &lora_upload.LocalStorage{Dir: "./uploads"},
+//		Rules:   map[string]lora_upload.Rule{"avatar": {MaxSize: 2 << 20, AllowedTypes: []string{"image/*"}}},
+//	}
+//	results, err := context.Upload(uploader, "avatar")
+type Uploader struct {
+	Storage     Storage
+	Rules       map[string]Rule //表单字段对应的规则
+	DefaultRule Rule            //没有单独设置规则的字段使用的规则
+	//计算哈希值的函数，为空时使用sha256
+	Hash func() hash.Hash
+	//生成存储的key，为空时使用"2006/01/02/随机字符串_文件名"
+	KeyFunc func(field, filename string) string
+}
+
+// 保存之后的文件信息
+type Result struct {
+	Field        string
+	OriginalName string //客户端传递的文件名称
+	Filename     string //处理之后的文件名称
+	Key          string
+	Location     string //Storage返回的访问位置
+	Size         int64
+	ContentType  string //根据文件内容判断的类型
+	Hash         string //十六进制的哈希值
+}
+
+// 上传失败的原因，实现了StatusCode，可以直接交给engine的errHandler处理
+type UploadError struct {
+	Field    string
+	Filename string
+	Reason   string
+	Status   int
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("upload field [%s] file [%s]: %s", e.Field, e.Filename, e.Reason)
+}
+
+func (e *UploadError) StatusCode() int {
+	return e.Status
+}
+
+func (u *Uploader) rule(field string) Rule {
+	if rule, ok := u.Rules[field]; ok {
+		return rule
+	}
+	return u.DefaultRule
+}
+
+// 保存一个上传文件
+func (u *Uploader) Save(ctx context.Context, field string, fh *multipart.FileHeader) (*Result, error) {
+	rule := u.rule(field)
+	if rule.MaxSize > 0 && fh.Size > rule.MaxSize {
+		return nil, &UploadError{Field: field, Filename: fh.Filename, Status: http.StatusRequestEntityTooLarge,
+			Reason: fmt.Sprintf("file size %d exceeds the limit of %d bytes", fh.Size, rule.MaxSize)}
+	}
+	file, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	if !allowedType(rule.AllowedTypes, contentType) {
+		return nil, &UploadError{Field: field, Filename: fh.Filename, Status: http.StatusUnsupportedMediaType,
+			Reason: fmt.Sprintf("file type %s is not allowed", contentType)}
+	}
+	filename := SanitizeFilename(fh.Filename)
+	key := u.key(field, filename)
+	hasher := u.newHash()
+	counter := &countingReader{r: io.MultiReader(bytes.NewReader(head), file)}
+	var reader io.Reader = counter
+	if rule.MaxSize > 0 {
+		//FileHeader.Size来自客户端，实际读取的时候再限制一次
+		reader = &limitReader{r: counter, remain: rule.MaxSize}
+	}
+	location, err := u.Storage.Save(ctx, key, io.TeeReader(reader, hasher), FileInfo{Size: fh.Size, ContentType: contentType})
+	if err != nil {
+		if errors.Is(err, errTooLarge) {
+			return nil, &UploadError{Field: field, Filename: fh.Filename, Status: http.StatusRequestEntityTooLarge,
+				Reason: fmt.Sprintf("file exceeds the limit of %d bytes", rule.MaxSize)}
+		}
+		return nil, err
+	}
+	return &Result{
+		Field:        field,
+		OriginalName: fh.Filename,
+		Filename:     filename,
+		Key:          key,
+		Location:     location,
+		Size:         counter.n,
+		ContentType:  contentType,
+		Hash:         hex.EncodeToString(hasher.Sum(nil)),
+	}, nil
+}
+
+// 保存表单中多个字段的所有文件，有一个失败时删除已经保存的文件
+// fields为空时保存表单中所有的文件
+func (u *Uploader) SaveAll(ctx context.Context, form *multipart.Form, fields ...string) ([]*Result, error) {
+	if form == nil {
+		return nil, http.ErrMissingFile
+	}
+	if len(fields) == 0 {
+		for field := range form.File {
+			fields = append(fields, field)
+		}
+	}
+	results := make([]*Result, 0)
+	for _, field := range fields {
+		files := form.File[field]
+		if maxFiles := u.rule(field).MaxFiles; maxFiles > 0 && len(files) > maxFiles {
+			u.rollback(ctx, results)
+			return nil, &UploadError{Field: field, Status: http.StatusBadRequest,
+				Reason: fmt.Sprintf("%d files exceed the limit of %d", len(files), maxFiles)}
+		}
+		for _, fh := range files {
+			result, err := u.Save(ctx, field, fh)
+			if err != nil {
+				u.rollback(ctx, results)
+				return nil, err
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func (u *Uploader) rollback(ctx context.Context, results []*Result) {
+	for _, result := range results {
+		u.Storage.Delete(context.WithoutCancel(ctx), result.Key)
+	}
+}
+
+func (u *Uploader) newHash() hash.Hash {
+	if u.Hash != nil {
+		return u.Hash()
+	}
+	return sha256.New()
+}
+
+func (u *Uploader) key(field, filename string) string {
+	if u.KeyFunc != nil {
+		return u.KeyFunc(field, filename)
+	}
+	random := make([]byte, 8)
+	rand.Read(random)
+	return path.Join(time.Now().Format("2006/01/02"), hex.EncodeToString(random)+"_"+filename)
+}
+
+// 判断文件类型是否在允许的列表中，支持image/*这种写法
+func allowedType(allowed []string, contentType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(mediaType)
+	for _, t := range allowed {
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if strings.EqualFold(t, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+const maxFilenameLen = 255
+
+// 处理客户端传递的文件名称，去掉路径，控制字符和文件系统不允许的字符
+// 调用方式:lora_upload.SanitizeFilename("../../etc/passwd") 返回 "passwd"
+func SanitizeFilename(name string) string {
+	//windows客户端可能传递完整的路径
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	var sb strings.Builder
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError || unicode.IsControl(r):
+			continue
+		case strings.ContainsRune(`<>:"|?*`, r):
+			sb.WriteRune('_')
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	name = strings.Trim(sb.String(), ". ")
+	if len(name) > maxFilenameLen {
+		//尽量保留扩展名
+		ext := path.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		base := name[:maxFilenameLen-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		name = base + ext
+	}
+	if name == "" {
+		return "file"
+	}
+	return name
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+var errTooLarge = errors.New("upload file too large")
+
+// 和io.LimitReader不同，超过限制时返回错误而不是截断
+type limitReader struct {
+	r      io.Reader
+	remain int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.remain -= int64(n)
+	if l.remain < 0 {
+		return n, errTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,583 @@
+package bind
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/LorraineWen/lorago/lora_bind"
+	"github.com/LorraineWen/lorago/lora_render"
+	"github.com/go-playground/validator"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type User struct {
+	Name string   `form:"name"`
+	Age  int      `form:"age"`
+	Tags []string `form:"tag"`
+}
+
+func TestDefaultBinder(t *testing.T) {
+	cases := []struct {
+		method      string
+		contentType string
+		name        string
+	}{
+		{http.MethodGet, "", "query"},
+		{http.MethodPost, "application/json; charset=utf-8", "json"},
+		{http.MethodPost, "text/xml", "xml"},
+		{http.MethodPost, "application/x-www-form-urlencoded", "form"},
+		{http.MethodPut, "multipart/form-data; boundary=xxx", "multipart/form-data"},
+	}
+	for _, c := range cases {
+		b, err := lora_bind.Default(c.method, c.contentType)
+		if err != nil {
+			t.Fatalf("%s %s: %v", c.method, c.contentType, err)
+		}
+		if b.Name() != c.name {
+			t.Fatalf("%s %s: got binder %s, want %s", c.method, c.contentType, b.Name(), c.name)
+		}
+	}
+	_, err := lora_bind.Default(http.MethodPost, "application/unknown")
+	var mediaTypeError *lora_bind.UnsupportedMediaTypeError
+	if !errors.As(err, &mediaTypeError) || mediaTypeError.StatusCode() != http.StatusUnsupportedMediaType {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestFormBinder(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/user?tag=a", strings.NewReader("name=amie&age=18&tag=b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	user := &User{}
+	if err := lora_bind.FormBinder.Bind(req, user); err != nil {
+		t.Fatal(err)
+	}
+	if user.Name != "amie" || user.Age != 18 || len(user.Tags) != 2 {
+		t.Fatalf("unexpected user %+v", user)
+	}
+}
+
+type Address struct {
+	City string `form:"city"`
+}
+
+type Profile struct {
+	Name     string                `form:"name"`
+	Score    float64               `form:"score"`
+	Admin    bool                  `form:"admin"`
+	Birthday time.Time             `form:"birthday" time_format:"2006-01-02" time_utc:"1"`
+	Address  *Address              `form:"address"`
+	Avatar   *multipart.FileHeader `form:"avatar"`
+}
+
+func TestFormMultipartBinder(t *testing.T) {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("user[name]", "amie")
+	writer.WriteField("user[score]", "9.5")
+	writer.WriteField("user[admin]", "true")
+	writer.WriteField("user[birthday]", "2000-01-02")
+	writer.WriteField("user[address][city]", "chengdu")
+	part, _ := writer.CreateFormFile("user[avatar]", "avatar.png")
+	part.Write([]byte("png"))
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/user", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	form := &struct {
+		User Profile `form:"user"`
+	}{}
+	if err := lora_bind.FormMultipartBinder.Bind(req, form); err != nil {
+		t.Fatal(err)
+	}
+	user := form.User
+	if user.Name != "amie" || user.Score != 9.5 || !user.Admin {
+		t.Fatalf("unexpected user %+v", user)
+	}
+	if !user.Birthday.Equal(time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected birthday %v", user.Birthday)
+	}
+	if user.Address == nil || user.Address.City != "chengdu" {
+		t.Fatalf("unexpected address %+v", user.Address)
+	}
+	if user.Avatar == nil || user.Avatar.Filename != "avatar.png" {
+		t.Fatalf("unexpected avatar %+v", user.Avatar)
+	}
+}
+
+type Category struct {
+	Name   string `form:"name"`
+	Parent *Category
+}
+
+// 嵌入自身的结构体
+type TreeNode struct {
+	*TreeNode
+	Name string `form:"name"`
+}
+
+// 自引用的结构体只在存在对应前缀的参数时才继续映射
+func TestFormBinderRecursiveStruct(t *testing.T) {
+	cases := []struct {
+		body  string
+		names []string
+	}{
+		{"name=a", []string{"a"}},
+		{"name=a&Parent[name]=b&Parent[Parent][name]=c", []string{"a", "b", "c"}},
+		{"Parent[Parent][name]=c", []string{"", "", "c"}},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/category", strings.NewReader(c.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		category := &Category{}
+		if err := lora_bind.FormBinder.Bind(req, category); err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, 0)
+		for node := category; node != nil; node = node.Parent {
+			names = append(names, node.Name)
+		}
+		if !reflect.DeepEqual(names, c.names) {
+			t.Fatalf("%q: got %v, want %v", c.body, names, c.names)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPost, "/node", strings.NewReader("name=root"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	node := &TreeNode{}
+	if err := lora_bind.FormBinder.Bind(req, node); err != nil || node.Name != "root" {
+		t.Fatalf("unexpected node %+v, %v", node, err)
+	}
+}
+
+type ListRequest struct {
+	Id    int      `uri:"id"`
+	Page  int      `query:"page" default:"1"`
+	Size  int      `query:"size" default:"10"`
+	Sort  []string `query:"sort" default:"id,name"`
+	Token string   `header:"x-token"`
+	Lang  string   `cookie:"lang" default:"zh"`
+}
+
+func TestBindRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/user/get/7?size=20", nil)
+	req.Header.Set("X-Token", "abc")
+	req.AddCookie(&http.Cookie{Name: "lang", Value: "en"})
+	list := &ListRequest{}
+	if err := lora_bind.BindRequest(req, map[string][]string{"id": {"7"}}, list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Id != 7 || list.Page != 1 || list.Size != 20 || list.Token != "abc" || list.Lang != "en" {
+		t.Fatalf("unexpected request %+v", list)
+	}
+	if len(list.Sort) != 2 || list.Sort[1] != "name" {
+		t.Fatalf("unexpected sort %v", list.Sort)
+	}
+}
+
+type HeaderRequest struct {
+	Token   string   `header:"x-token"`
+	Version int      `header:"X-Version" default:"1"`
+	Accept  []string `header:"Accept"`
+	Trace   string   `header:"X-Trace"`
+}
+
+func TestHeaderBinder(t *testing.T) {
+	cases := []struct {
+		headers http.Header
+		want    HeaderRequest
+		invalid bool
+	}{
+		{http.Header{"X-Token": {"abc"}, "X-Version": {"2"}}, HeaderRequest{Token: "abc", Version: 2}, false},
+		{http.Header{"Accept": {"text/html", "application/json"}}, HeaderRequest{Version: 1, Accept: []string{"text/html", "application/json"}}, false},
+		{http.Header{}, HeaderRequest{Version: 1}, false},
+		{http.Header{"X-Version": {"v2"}}, HeaderRequest{}, true},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header = c.headers
+		got := HeaderRequest{}
+		err := lora_bind.HeaderBinder.Bind(req, &got)
+		if c.invalid {
+			if err == nil {
+				t.Fatalf("%v: expected an error", c.headers)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%v: got %+v, %v, want %+v", c.headers, got, err, c.want)
+		}
+	}
+}
+
+type UriRequest struct {
+	Id   int    `uri:"id"`
+	Kind string `uri:"kind" default:"post"`
+	Slug string `uri:"slug"`
+}
+
+func TestUriBinder(t *testing.T) {
+	cases := []struct {
+		params  map[string][]string
+		want    UriRequest
+		invalid bool
+	}{
+		{map[string][]string{"id": {"7"}, "kind": {"page"}, "slug": {"hello"}}, UriRequest{Id: 7, Kind: "page", Slug: "hello"}, false},
+		{map[string][]string{"id": {"7"}}, UriRequest{Id: 7, Kind: "post"}, false},
+		{nil, UriRequest{Kind: "post"}, false},
+		{map[string][]string{"id": {"x"}}, UriRequest{}, true},
+	}
+	for _, c := range cases {
+		got := UriRequest{}
+		err := lora_bind.UriBinder.BindUri(c.params, &got)
+		if c.invalid {
+			if err == nil {
+				t.Fatalf("%v: expected an error", c.params)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Fatalf("%v: got %+v, %v, want %+v", c.params, got, err, c.want)
+		}
+	}
+}
+
+type CookieRequest struct {
+	Lang  string `cookie:"lang" default:"zh"`
+	Name  string `cookie:"name"`
+	Theme string `cookie:"theme"`
+	Count int    `cookie:"count"`
+}
+
+func TestCookieBinder(t *testing.T) {
+	cases := []struct {
+		cookies []*http.Cookie
+		want    CookieRequest
+		invalid bool
+	}{
+		{[]*http.Cookie{{Name: "lang", Value: "en"}, {Name: "name", Value: "%E6%B5%8B%E8%AF%95"}}, CookieRequest{Lang: "en", Name: "测试"}, false},
+		{[]*http.Cookie{{Name: "count", Value: "3"}}, CookieRequest{Lang: "zh", Count: 3}, false},
+		{nil, CookieRequest{Lang: "zh"}, false},
+		{[]*http.Cookie{{Name: "count", Value: "many"}}, CookieRequest{}, true},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, cookie := range c.cookies {
+			req.AddCookie(cookie)
+		}
+		got := CookieRequest{}
+		err := lora_bind.CookieBinder.Bind(req, &got)
+		if c.invalid {
+			if err == nil {
+				t.Fatalf("%v: expected an error", c.cookies)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Fatalf("%v: got %+v, %v, want %+v", c.cookies, got, err, c.want)
+		}
+	}
+}
+
+// 自引用的结构体通过请求路径参数绑定，BindRequest只绑定带标签的属性
+func TestQueryBinderRecursiveStruct(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/category?name=a&Parent[name]=b", nil)
+	category := &Category{}
+	if err := lora_bind.QueryBinder.Bind(req, category); err != nil {
+		t.Fatal(err)
+	}
+	if category.Name != "a" || category.Parent == nil || category.Parent.Name != "b" || category.Parent.Parent != nil {
+		t.Fatalf("unexpected category %+v", category)
+	}
+	category = &Category{}
+	if err := lora_bind.BindRequest(req, nil, category); err != nil {
+		t.Fatal(err)
+	}
+	if category.Name != "a" || category.Parent != nil {
+		t.Fatalf("untagged struct field should not be bound, got %+v", category)
+	}
+}
+
+type Account struct {
+	Name  string `json:"name" validate:"required"`
+	Age   int    `json:"age" validate:"max=150"`
+	Phone string `json:"phone" validate:"mobile"`
+}
+
+func TestValidationErrors(t *testing.T) {
+	err := lora_bind.Validator.RegisterValidation("mobile", func(fl validator.FieldLevel) bool {
+		return len(fl.Field().String()) == 11
+	}, map[string]string{"en": "{0} must be a mobile number", "zh": "{0}必须是手机号"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = lora_bind.Validator.ValidateStruct([]Account{{Name: "amie", Age: 18, Phone: "13800000000"}, {Age: 200, Phone: "1"}})
+	var validationErrors lora_bind.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(validationErrors) != 3 {
+		t.Fatalf("unexpected errors %+v", validationErrors)
+	}
+	first := validationErrors[0]
+	if first.Field != "[1].name" || first.Rule != "required" || first.Message != "name is a required field" {
+		t.Fatalf("unexpected error %+v", first)
+	}
+	if validationErrors[1].Param != "150" {
+		t.Fatalf("unexpected error %+v", validationErrors[1])
+	}
+	zh := validationErrors.Localize("zh")
+	if zh[0].Message != "name为必填字段" || zh[2].Message != "phone必须是手机号" {
+		t.Fatalf("unexpected localized errors %+v", zh)
+	}
+}
+
+type Item struct {
+	Sku   string `json:"sku" binding:"required"`
+	Count int64  `json:"count"`
+}
+
+type Order struct {
+	Id    int64           `json:"id" binding:"required"`
+	Items []Item          `json:"items"`
+	Extra map[string]Item `json:"extra"`
+	Owner *struct {
+		Name string `json:"name" binding:"required"`
+	} `json:"owner"`
+}
+
+func TestJsonBinderRequired(t *testing.T) {
+	body := `{"id": 9007199254740993, "items": [{"sku": "a"}, {"count": 2}], "extra": {"gift": {"count": 1}}, "owner": {}}`
+	req := httptest.NewRequest(http.MethodPost, "/order", strings.NewReader(body))
+	binder := lora_bind.JsonBinder
+	binder.IsValidate = true
+	order := &Order{}
+	err := binder.Bind(req, order)
+	var validationErrors lora_bind.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	fields := make([]string, 0)
+	for _, fe := range validationErrors {
+		fields = append(fields, fe.Field)
+	}
+	want := "items[1].sku,extra.gift.sku,owner.name"
+	if strings.Join(fields, ",") != want {
+		t.Fatalf("got %v, want %s", fields, want)
+	}
+	//数字直接解码到int64，不会因为经过float64丢失精度
+	if order.Id != 9007199254740993 {
+		t.Fatalf("unexpected id %d", order.Id)
+	}
+}
+
+type Base struct {
+	Tenant string `json:"tenant" binding:"required"`
+}
+
+type Shipment struct {
+	*Base
+	Id       int64            `json:"id,string" binding:"required"`
+	Code     string           `json:"code" binding:"required"`
+	Created  time.Time        `json:"created" binding:"required"`
+	Boxes    [2]Item          `json:"boxes"`
+	ByWeight map[int]Item     `json:"by_weight"`
+	Tags     []string         `json:"tags" binding:"required"`
+	Meta     map[string]any   `json:"meta"`
+	Items    []*Item          `json:"items"`
+	Extra    *json.RawMessage `json:"extra"`
+}
+
+func bindShipment(t *testing.T, body string, disallowUnknownFields bool) (*Shipment, error) {
+	binder := lora_bind.JsonBinder
+	binder.IsValidate = true
+	binder.DisallowUnknownFields = disallowUnknownFields
+	shipment := &Shipment{}
+	err := binder.Bind(httptest.NewRequest(http.MethodPost, "/shipment", strings.NewReader(body)), shipment)
+	return shipment, err
+}
+
+func TestJsonBinderRequiredDecodesLikeEncodingJson(t *testing.T) {
+	body := `{"tenant": "t1", "id": "42", "CODE": "x", "created": "2024-01-02T03:04:05Z", "boxes": [{"sku": "a"}, {"sku": "b"}, {"sku": "c"}],
+		"by_weight": {"10": {"sku": "w"}}, "tags": [], "meta": {"n": 1.5, "list": [1, "a"]}, "items": [null, {"sku": "i"}], "extra": {"raw": true}, "unknown": [1, {"a": 2}]}`
+	got, err := bindShipment(t, body, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Shipment{}
+	if err = json.Unmarshal([]byte(body), want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if _, err = bindShipment(t, body, true); err == nil || !strings.Contains(err.Error(), `unknown field "unknown"`) {
+		t.Fatalf("unknown field should fail, got %v", err)
+	}
+}
+
+func TestJsonBinderRequiredNull(t *testing.T) {
+	body := `{"tenant": null, "id": null, "code": null, "created": null, "tags": null, "boxes": [{"sku": null}]}`
+	_, err := bindShipment(t, body, false)
+	var validationErrors lora_bind.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	fields := make([]string, 0)
+	for _, fe := range validationErrors {
+		fields = append(fields, fe.Field)
+	}
+	want := "boxes[0].sku,tenant,id,code,created,tags"
+	if strings.Join(fields, ",") != want {
+		t.Fatalf("got %v, want %s", fields, want)
+	}
+}
+
+func TestJsonBinderRequiredTypeError(t *testing.T) {
+	for _, body := range []string{`{"tenant": "t", "boxes": {"sku": "a"}}`, `[]`, `{"tags": [1]}`, `{"by_weight": {"heavy": {}}}`, `{"code": "x"`} {
+		_, err := bindShipment(t, body, false)
+		var validationErrors lora_bind.ValidationErrors
+		if err == nil || errors.As(err, &validationErrors) {
+			t.Fatalf("%s: expected a decode error, got %v", body, err)
+		}
+	}
+}
+
+type Signup struct {
+	Name    string `form:"name" binding:"required"`
+	Lang    string `form:"lang" default:"zh" binding:"required"`
+	Profile *struct {
+		Email string `form:"email" binding:"required"`
+	} `form:"profile" binding:"required"`
+}
+
+// 表单和请求路径参数绑定器的required检查和json绑定器一样，只在IsValidate为true时进行
+func TestFormBinderRequired(t *testing.T) {
+	cases := []struct {
+		query   string
+		missing string
+	}{
+		{"name=a&profile[email]=b", ""},
+		{"", "name,profile"},
+		{"name=a&profile[nick]=b", "profile[email]"},
+	}
+	for _, c := range cases {
+		binder := lora_bind.QueryBinder
+		binder.IsValidate = true
+		err := binder.Bind(httptest.NewRequest(http.MethodGet, "/signup?"+c.query, nil), &Signup{})
+		fields := make([]string, 0)
+		var validationErrors lora_bind.ValidationErrors
+		if errors.As(err, &validationErrors) {
+			for _, fe := range validationErrors {
+				fields = append(fields, fe.Field)
+			}
+		} else if err != nil {
+			t.Fatalf("%q: unexpected error %v", c.query, err)
+		}
+		if strings.Join(fields, ",") != c.missing {
+			t.Fatalf("%q: got %v, want %s", c.query, fields, c.missing)
+		}
+		formBinder := lora_bind.FormBinder
+		formBinder.IsValidate = true
+		req := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(c.query))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if err = formBinder.Bind(req, &Signup{}); (err != nil) != (c.missing != "") {
+			t.Fatalf("form %q: unexpected error %v", c.query, err)
+		}
+		if err = lora_bind.QueryBinder.Bind(httptest.NewRequest(http.MethodGet, "/signup?"+c.query, nil), &Signup{}); err != nil {
+			t.Fatalf("%q: required should not be checked without IsValidate, got %v", c.query, err)
+		}
+	}
+}
+
+func TestDecodeJsonArray(t *testing.T) {
+	body := `[{"sku": "a", "count": 1}, {"sku": "b", "count": 2}, {"sku": "c", "count": 3}]`
+	total := int64(0)
+	err := lora_bind.DecodeJsonArray(strings.NewReader(body), func(item *Item) error {
+		total += item.Count
+		return nil
+	})
+	if err != nil || total != 6 {
+		t.Fatalf("unexpected result %d %v", total, err)
+	}
+	decoder := lora_bind.NewJsonArrayDecoder(strings.NewReader(`{"sku": "a"}`))
+	if err = decoder.Decode(&Item{}); err == nil {
+		t.Fatal("object body should fail")
+	}
+}
+
+func TestJsonArrayDecoderErr(t *testing.T) {
+	cases := []struct {
+		body  string
+		count int
+		fail  bool
+	}{
+		{`[{"sku": "a"}, {"sku": "b"}]`, 2, false},
+		{`[]`, 0, false},
+		{`{"sku": "a"}`, 0, true},
+		{`[{"sku": "a"}, `, 1, true},
+		{``, 0, true},
+	}
+	for _, c := range cases {
+		decoder := lora_bind.NewJsonArrayDecoder(strings.NewReader(c.body))
+		for decoder.More() {
+			if err := decoder.Decode(&Item{}); err != nil {
+				break
+			}
+		}
+		if decoder.Count() != c.count || (decoder.Err() != nil) != c.fail {
+			t.Fatalf("%q: got count %d, err %v", c.body, decoder.Count(), decoder.Err())
+		}
+		if c.fail && decoder.Decode(&Item{}) == nil {
+			t.Fatalf("%q: Decode after an error should keep failing", c.body)
+		}
+	}
+}
+
+type Config struct {
+	Name string `yaml:"name" toml:"name" msgpack:"name"`
+	Port int    `yaml:"port" toml:"port" msgpack:"port"`
+}
+
+// 先通过render编码，再通过对应的绑定器解码
+func TestRenderAndBind(t *testing.T) {
+	cases := []struct {
+		render      lora_render.Render
+		contentType string
+	}{
+		{&lora_render.YamlRender{Data: Config{Name: "amie", Port: 8080}}, "application/x-yaml"},
+		{&lora_render.TomlRender{Data: Config{Name: "amie", Port: 8080}}, "application/toml"},
+		{&lora_render.MsgPackRender{Data: Config{Name: "amie", Port: 8080}}, "application/msgpack"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		if err := c.render.Render(w, http.StatusOK); err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/config", w.Body)
+		binder, err := lora_bind.Default(http.MethodPost, w.Header().Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf := &Config{}
+		if err = binder.Bind(req, conf); err != nil {
+			t.Fatalf("%s: %v", c.contentType, err)
+		}
+		if conf.Name != "amie" || conf.Port != 8080 {
+			t.Fatalf("%s: unexpected config %+v", c.contentType, conf)
+		}
+	}
+	w := httptest.NewRecorder()
+	if err := (&lora_render.ProtoBufRender{Data: wrapperspb.String("amie")}).Render(w, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	message := &wrapperspb.StringValue{}
+	req := httptest.NewRequest(http.MethodPost, "/config", w.Body)
+	if err := lora_bind.ProtoBufBinder.Bind(req, message); err != nil || message.Value != "amie" {
+		t.Fatalf("unexpected message %v %v", message, err)
+	}
+}
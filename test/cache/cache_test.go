@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/LorraineWen/lorago/lora_cache"
+	"github.com/LorraineWen/lorago/lora_render"
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEvict(t *testing.T) {
+	cache := lora_cache.NewLRUCache(2)
+	cache.Set("a", []byte("1"), 0)
+	cache.Set("b", []byte("2"), 0)
+	cache.Get("a") //a变成最近访问的数据，b会被淘汰
+	cache.Set("c", []byte("3"), 0)
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("b should be evicted")
+	}
+	if value, ok := cache.Get("a"); !ok || string(value) != "1" {
+		t.Fatalf("unexpected value of a: %q %v", value, ok)
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("unexpected len %d", cache.Len())
+	}
+}
+
+func TestLRUCacheTTL(t *testing.T) {
+	cache := lora_cache.NewLRUCache(10)
+	cache.Set("a", []byte("1"), 10*time.Millisecond)
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatal("a should exist")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.Get("a"); ok {
+		t.Fatal("a should be expired")
+	}
+}
+
+// 每次真正执行时calls加1的处理函数，响应体中带上calls和page参数
+func listHandler(calls *int, setCookie bool) lora_router.HandleFunc {
+	return func(ctx *lora_router.Context) {
+		*calls++
+		if setCookie {
+			ctx.SetCookie("sid", "1", 0, "/", "", false, true)
+		}
+		ctx.StringResponseWrite(http.StatusOK, "%d page=%s", *calls, ctx.GetQuery("page"))
+	}
+}
+
+func TestCacheMiddlewareHit(t *testing.T) {
+	calls := 0
+	engine := testutil.NewEngine("/user/list", listHandler(&calls, false), (&lora_router.CacheEntity{}).CacheMiddleware)
+	first := testutil.Get(engine, "/user/list", nil)
+	second := testutil.Get(engine, "/user/list", nil)
+	if calls != 1 {
+		t.Fatalf("handler called %d times", calls)
+	}
+	if first.Body.String() != "1 page=" || second.Body.String() != first.Body.String() {
+		t.Fatalf("unexpected bodies %q %q", first.Body.String(), second.Body.String())
+	}
+	if second.Header().Get("Content-Type") != first.Header().Get("Content-Type") {
+		t.Fatal("cached response lost its headers")
+	}
+}
+
+func TestCacheMiddlewareETag(t *testing.T) {
+	calls := 0
+	engine := testutil.NewEngine("/user/list", listHandler(&calls, false), (&lora_router.CacheEntity{}).CacheMiddleware)
+	first := testutil.Get(engine, "/user/list", nil)
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		w := testutil.Get(engine, "/user/list", map[string]string{"If-None-Match": ifNoneMatch})
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+			t.Fatalf("If-None-Match %s: got %d %q", ifNoneMatch, w.Code, w.Body.String())
+		}
+	}
+	if w := testutil.Get(engine, "/user/list", map[string]string{"If-None-Match": `"other"`}); w.Code != http.StatusOK {
+		t.Fatalf("mismatched etag: got %d", w.Code)
+	}
+	if calls != 1 {
+		t.Fatalf("handler called %d times", calls)
+	}
+}
+
+func TestCacheMiddlewareNoCache(t *testing.T) {
+	calls := 0
+	engine := testutil.NewEngine("/user/list", listHandler(&calls, false), (&lora_router.CacheEntity{}).CacheMiddleware)
+	testutil.Get(engine, "/user/list", nil)
+	//no-cache跳过缓存重新计算，并且用新的结果更新缓存
+	if w := testutil.Get(engine, "/user/list", map[string]string{"Cache-Control": "no-cache"}); w.Body.String() != "2 page=" {
+		t.Fatalf("no-cache should bypass the cache, got %q", w.Body.String())
+	}
+	if w := testutil.Get(engine, "/user/list", nil); w.Body.String() != "2 page=" {
+		t.Fatalf("no-cache should refresh the cache, got %q", w.Body.String())
+	}
+	//no-store的请求不会更新缓存
+	testutil.Get(engine, "/user/list", map[string]string{"Cache-Control": "no-cache, no-store"})
+	if w := testutil.Get(engine, "/user/list", nil); w.Body.String() != "2 page=" {
+		t.Fatalf("no-store should not update the cache, got %q", w.Body.String())
+	}
+}
+
+func TestCacheMiddlewareSkipsSetCookie(t *testing.T) {
+	calls := 0
+	engine := testutil.NewEngine("/user/list", listHandler(&calls, true), (&lora_router.CacheEntity{}).CacheMiddleware)
+	for i := 1; i <= 3; i++ {
+		w := testutil.Get(engine, "/user/list", nil)
+		if w.Body.String() != fmt.Sprintf("%d page=", i) {
+			t.Fatalf("response with Set-Cookie was cached: %q", w.Body.String())
+		}
+		if w.Header().Get("Set-Cookie") == "" {
+			t.Fatal("missing Set-Cookie")
+		}
+	}
+}
+
+func TestCacheMiddlewareQueryKeys(t *testing.T) {
+	calls := 0
+	engine := testutil.NewEngine("/user/list", listHandler(&calls, false), (&lora_router.CacheEntity{QueryKeys: []string{"page"}}).CacheMiddleware)
+	cases := []struct {
+		target string
+		want   string
+	}{
+		{"/user/list?page=1", "1 page=1"},
+		{"/user/list?page=2", "2 page=2"},
+		{"/user/list?page=1", "1 page=1"},
+		//不参与生成key的参数不会影响缓存
+		{"/user/list?page=2&sort=name", "2 page=2"},
+		{"/user/list", "3 page="},
+	}
+	for _, c := range cases {
+		if w := testutil.Get(engine, c.target, nil); w.Body.String() != c.want {
+			t.Fatalf("%s: got %q, want %q", c.target, w.Body.String(), c.want)
+		}
+	}
+}
+
+func TestCacheMiddlewareTTL(t *testing.T) {
+	calls := 0
+	engine := testutil.NewEngine("/user/list", listHandler(&calls, false), (&lora_router.CacheEntity{TTL: 20 * time.Millisecond}).CacheMiddleware)
+	testutil.Get(engine, "/user/list", nil)
+	time.Sleep(40 * time.Millisecond)
+	if w := testutil.Get(engine, "/user/list", nil); w.Body.String() != "2 page=" {
+		t.Fatalf("expired entry was served: %q", w.Body.String())
+	}
+}
+
+// Negotiate的响应带有Vary: Accept，没有把Accept加入HeaderKeys时不缓存，加入之后按Accept分别缓存
+func TestCacheMiddlewareVary(t *testing.T) {
+	infoHandler := func(calls *int) lora_router.HandleFunc {
+		return func(ctx *lora_router.Context) {
+			*calls++
+			ctx.Negotiate(http.StatusOK, fmt.Sprint(*calls), lora_render.MIMEJSON, lora_render.MIMEXML2)
+		}
+	}
+	for _, headerKeys := range [][]string{nil, {"accept"}} {
+		calls := 0
+		engine := testutil.NewEngine("/user/info", infoHandler(&calls), (&lora_router.CacheEntity{HeaderKeys: headerKeys}).CacheMiddleware)
+		for i := 0; i < 2; i++ {
+			for accept, contentType := range map[string]string{"application/json": "json", "text/xml": "xml"} {
+				w := testutil.Get(engine, "/user/info", map[string]string{"Accept": accept})
+				if w.Code != http.StatusOK || !strings.Contains(w.Header().Get("Content-Type"), contentType) {
+					t.Fatalf("%v: Accept %s got %d %q", headerKeys, accept, w.Code, w.Header().Get("Content-Type"))
+				}
+			}
+		}
+		want := 4
+		if headerKeys != nil {
+			want = 2
+		}
+		if calls != want {
+			t.Fatalf("%v: handler called %d times, want %d", headerKeys, calls, want)
+		}
+	}
+	//Vary: *的响应不能缓存
+	calls := 0
+	engine := testutil.NewEngine("/user/any", func(ctx *lora_router.Context) {
+		calls++
+		ctx.W.Header().Set("Vary", "*")
+		ctx.StringResponseWrite(http.StatusOK, "%d", calls)
+	}, (&lora_router.CacheEntity{HeaderKeys: []string{"Accept"}}).CacheMiddleware)
+	testutil.Get(engine, "/user/any", nil)
+	if w := testutil.Get(engine, "/user/any", nil); w.Body.String() != "2" {
+		t.Fatalf("Vary: * response was cached: %q", w.Body.String())
+	}
+}
@@ -0,0 +1,283 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/LorraineWen/lorago/lora_proxy"
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func upstreams(t *testing.T, targets ...string) []*lora_proxy.Upstream {
+	ret := make([]*lora_proxy.Upstream, 0, len(targets))
+	for _, target := range targets {
+		upstream, err := lora_proxy.NewUpstream(target, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, upstream)
+	}
+	return ret
+}
+
+func pick(b lora_proxy.Balancer, list []*lora_proxy.Upstream, n int) string {
+	ret := ""
+	for i := 0; i < n; i++ {
+		ret += b.Next(nil, list).URL.Host
+	}
+	return ret
+}
+
+func TestRoundRobin(t *testing.T) {
+	list := upstreams(t, "http://a", "http://b", "http://c")
+	if got := pick(&lora_proxy.RoundRobin{}, list, 7); got != "abcabca" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	list := upstreams(t, "http://a", "http://b", "http://c")
+	list[0].Weight = 5
+	//和nginx的平滑加权轮询一致，权重高的上游不会被连续选中太多次
+	if got := pick(&lora_proxy.Weighted{}, list, 14); got != "aabacaaaabacaa" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+// 上游服务，将收到的请求信息以json格式返回
+type echo struct {
+	Name   string
+	Path   string
+	Host   string
+	Header http.Header
+}
+
+func newUpstream(t *testing.T, name string, handler http.HandlerFunc) *httptest.Server {
+	if handler == nil {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(echo{Name: name, Path: r.URL.Path, Host: r.Host, Header: r.Header})
+		}
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func do(engine *lora_router.Engine, r *http.Request) (*httptest.ResponseRecorder, echo) {
+	w := testutil.Serve(engine, r)
+	var ret echo
+	json.Unmarshal(w.Body.Bytes(), &ret)
+	return w, ret
+}
+
+func TestProxyRewritesHeaders(t *testing.T) {
+	upstream := newUpstream(t, "a", nil)
+	p, err := lora_proxy.New(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.StripPrefix = "/legacy"
+	p.SetHeaders = map[string]string{"X-Gateway": "lora"}
+	p.RemoveHeaders = []string{"Authorization"}
+	engine := testutil.NewEngine("/legacy/**", p.Handle)
+
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/legacy/user/1", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w, got := do(engine, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	if got.Path != "/user/1" {
+		t.Fatalf("prefix not stripped: %q", got.Path)
+	}
+	if got.Host != upstream.Listener.Addr().String() {
+		t.Fatalf("host should be the upstream host, got %q", got.Host)
+	}
+	checks := map[string]string{
+		"X-Forwarded-For":   "192.0.2.1",
+		"X-Forwarded-Host":  "example.com",
+		"X-Forwarded-Proto": "http",
+		"X-Gateway":         "lora",
+		"Authorization":     "",
+	}
+	for key, want := range checks {
+		if value := got.Header.Get(key); value != want {
+			t.Fatalf("%s: got %q, want %q", key, value, want)
+		}
+	}
+
+	//开始转发之后不能修改配置，使用新的Proxy
+	p, _ = lora_proxy.New(upstream.URL)
+	p.PreserveHost = true
+	if _, got = do(testutil.NewEngine("/legacy/**", p.Handle), httptest.NewRequest(http.MethodGet, "http://example.com/legacy/", nil)); got.Host != "example.com" {
+		t.Fatalf("PreserveHost: got %q", got.Host)
+	}
+}
+
+// 前缀按照路径段匹配，去掉之后的路径以/开头
+func TestProxyStripPrefix(t *testing.T) {
+	upstream := newUpstream(t, "a", nil)
+	cases := []struct {
+		prefix string
+		target string
+		path   string
+	}{
+		{"/legacy", "/legacy/", "/"},
+		{"/legacy/", "/legacy/user/1", "/user/1"},
+		{"legacy", "/legacy/user/1", "/user/1"},
+		{"/leg", "/legacy/user/1", "/legacy/user/1"},
+		{"/legacy/us", "/legacy/user/1", "/legacy/user/1"},
+		{"/legacy/user", "/legacy/user", "/"},
+	}
+	for _, c := range cases {
+		p, _ := lora_proxy.New(upstream.URL)
+		p.StripPrefix = c.prefix
+		if w, got := do(testutil.NewEngine("/legacy/**", p.Handle), httptest.NewRequest(http.MethodGet, c.target, nil)); w.Code != http.StatusOK || got.Path != c.path {
+			t.Fatalf("%s %s: got %d %q, want %q", c.prefix, c.target, w.Code, got.Path, c.path)
+		}
+	}
+}
+
+func TestProxyRouteMiddleware(t *testing.T) {
+	hits := 0
+	upstream := newUpstream(t, "a", func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	})
+	p, _ := lora_proxy.New(upstream.URL)
+	auth := func(next lora_router.HandleFunc) lora_router.HandleFunc {
+		return func(ctx *lora_router.Context) {
+			if ctx.R.Header.Get("X-Token") != "ok" {
+				ctx.Fail(http.StatusUnauthorized, "unauthorized")
+				return
+			}
+			next(ctx)
+		}
+	}
+	engine := testutil.NewEngine("/legacy/**", p.Handle, auth)
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		w, _ := do(engine, httptest.NewRequest(method, "/legacy/admin", nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s without token: got %d", method, w.Code)
+		}
+	}
+	if hits != 0 {
+		t.Fatalf("upstream reached %d times without auth", hits)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/legacy/admin", nil)
+	r.Header.Set("X-Token", "ok")
+	if w, _ := do(engine, r); w.Code != http.StatusOK || hits != 1 {
+		t.Fatalf("with token: got %d, hits %d", w.Code, hits)
+	}
+}
+
+func TestProxyPassiveHealthCheck(t *testing.T) {
+	bad := newUpstream(t, "bad", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	good := newUpstream(t, "good", nil)
+	p, _ := lora_proxy.New(bad.URL, good.URL)
+	p.MaxFails = 2
+	p.FailTimeout = time.Hour
+	engine := testutil.NewEngine("/legacy/**", p.Handle)
+	statuses := make([]int, 0, 8)
+	for i := 0; i < 8; i++ {
+		w, _ := do(engine, httptest.NewRequest(http.MethodGet, "/legacy/", nil))
+		statuses = append(statuses, w.Code)
+	}
+	//轮询到bad两次之后bad被标记为不可用，之后都转发给good
+	want := []int{500, 200, 500, 200, 200, 200, 200, 200}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("got %v, want %v", statuses, want)
+		}
+	}
+	if p.Upstreams[0].Healthy() || !p.Upstreams[1].Healthy() {
+		t.Fatal("only the failing upstream should be marked down")
+	}
+}
+
+func TestProxyAllUpstreamsDown(t *testing.T) {
+	p, _ := lora_proxy.New("http://127.0.0.1:1")
+	p.FailTimeout = time.Hour
+	engine := testutil.NewEngine("/legacy/**", p.Handle)
+	if w, _ := do(engine, httptest.NewRequest(http.MethodGet, "/legacy/", nil)); w.Code != http.StatusBadGateway {
+		t.Fatalf("connection refused: got %d", w.Code)
+	}
+	if w, _ := do(engine, httptest.NewRequest(http.MethodGet, "/legacy/", nil)); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("no healthy upstream: got %d", w.Code)
+	}
+}
+
+func TestProxyTimeout(t *testing.T) {
+	slow := newUpstream(t, "slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	p, _ := lora_proxy.New(slow.URL)
+	p.Timeout = 20 * time.Millisecond
+	engine := testutil.NewEngine("/legacy/**", p.Handle)
+	if w, _ := do(engine, httptest.NewRequest(http.MethodGet, "/legacy/", nil)); w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("got %d", w.Code)
+	}
+	if p.Upstreams[0].Healthy() {
+		t.Fatal("a timed out upstream should be marked down")
+	}
+}
+
+func TestProxyClientAbortKeepsUpstreamHealthy(t *testing.T) {
+	received := make(chan struct{})
+	upstream := newUpstream(t, "a", func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-r.Context().Done()
+	})
+	p, _ := lora_proxy.New(upstream.URL)
+	engine := testutil.NewEngine("/legacy/**", p.Handle)
+	reqCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-received
+		cancel()
+	}()
+	do(engine, httptest.NewRequest(http.MethodGet, "/legacy/", nil).WithContext(reqCtx))
+	if !p.Upstreams[0].Healthy() {
+		t.Fatal("a client abort should not mark the upstream down")
+	}
+}
+
+func TestLeastConn(t *testing.T) {
+	release := make(chan struct{})
+	busy := newUpstream(t, "busy", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		json.NewEncoder(w).Encode(echo{Name: "busy"})
+	})
+	idle := newUpstream(t, "idle", nil)
+	p, _ := lora_proxy.New(busy.URL, idle.URL)
+	p.Balancer = lora_proxy.LeastConn{}
+	engine := testutil.NewEngine("/legacy/**", p.Handle)
+	done := make(chan string)
+	go func() {
+		_, got := do(engine, httptest.NewRequest(http.MethodGet, "/legacy/", nil))
+		done <- got.Name
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Upstreams[0].Active() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("first request did not reach the busy upstream")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		if _, got := do(engine, httptest.NewRequest(http.MethodGet, "/legacy/", nil)); got.Name != "idle" {
+			t.Fatalf("request %d went to %q", i, got.Name)
+		}
+	}
+	close(release)
+	if name := <-done; name != "busy" {
+		t.Fatalf("first request went to %q", name)
+	}
+}
@@ -0,0 +1,242 @@
+package render
+
+import (
+	"bytes"
+	"github.com/LorraineWen/lorago/lora_render"
+	"html/template"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestSSEventEncode(t *testing.T) {
+	var buf bytes.Buffer
+	event := lora_render.SSEvent{Id: "1", Event: "message", Retry: 3000, Data: "hello\nworld"}
+	if err := event.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "id: 1\nevent: message\nretry: 3000\ndata: hello\ndata: world\n\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestSSEventRender(t *testing.T) {
+	w := httptest.NewRecorder()
+	event := lora_render.SSEvent{Data: map[string]string{"name": "amie"}}
+	if err := event.Render(w, 200); err != nil {
+		t.Fatal(err)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if w.Body.String() != "data: {\"name\":\"amie\"}\n\n" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+}
+
+func TestNegotiateContentType(t *testing.T) {
+	offered := []string{lora_render.MIMEJSON, lora_render.MIMEXML, lora_render.MIMEHTML}
+	cases := []struct {
+		accept string
+		want   string
+	}{
+		{"", lora_render.MIMEJSON},
+		{"*/*", lora_render.MIMEJSON},
+		{"application/xml", lora_render.MIMEXML},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", lora_render.MIMEHTML},
+		{"application/json;q=0.5, application/xml", lora_render.MIMEXML},
+		{"text/*;q=0.3, application/json;q=0", lora_render.MIMEHTML},
+		{"image/png", ""},
+	}
+	for _, c := range cases {
+		if got := lora_render.NegotiateContentType(c.accept, offered); got != c.want {
+			t.Fatalf("accept %q: got %q, want %q", c.accept, got, c.want)
+		}
+	}
+}
+
+func TestJsonRenderVariants(t *testing.T) {
+	cases := []struct {
+		render lora_render.Render
+		want   string
+	}{
+		{&lora_render.JsonRender{Data: map[string]string{"html": "<b>"}}, "{\"html\":\"\\u003cb\\u003e\"}\n"},
+		{&lora_render.PureJsonRender{Data: map[string]string{"html": "<b>"}}, "{\"html\":\"<b>\"}\n"},
+		{&lora_render.IndentedJsonRender{Data: map[string]int{"id": 1}}, "{\n    \"id\": 1\n}\n"},
+		{&lora_render.SecureJsonRender{Data: []int{1, 2}}, "while(1);[1,2]"},
+		{&lora_render.SecureJsonRender{Data: map[string]int{"id": 1}}, "{\"id\":1}"},
+		{&lora_render.JsonpRender{Callback: "cb", Data: map[string]int{"id": 1}}, "/**/cb({\"id\":1});"},
+		{&lora_render.AsciiJsonRender{Data: map[string]string{"name": "小明😀"}}, "{\"name\":\"\\u5c0f\\u660e\\ud83d\\ude00\"}"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		if err := c.render.Render(w, 200); err != nil {
+			t.Fatal(err)
+		}
+		if w.Body.String() != c.want {
+			t.Fatalf("%T: got %q, want %q", c.render, w.Body.String(), c.want)
+		}
+	}
+	if err := (&lora_render.JsonpRender{Callback: "alert(1)//", Data: 1}).Render(httptest.NewRecorder(), 200); err == nil {
+		t.Fatal("expected invalid callback error")
+	}
+}
+
+func executePage(t *testing.T, set *lora_render.TemplateSet, name string, data any) string {
+	t.Helper()
+	page, err := set.Lookup(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := page.ExecuteTemplate(&buf, name, data); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestTemplateSetLayouts(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`<title>{{block "title" .}}default{{end}}</title>{{block "content" .}}{{end}}`)},
+		"pages/index.html":  {Data: []byte(`{{define "title"}}index{{end}}{{define "content"}}{{upper .}}{{end}}{{template "base.html" .}}`)},
+		"pages/about.html":  {Data: []byte(`{{define "content"}}about{{end}}{{template "base.html" .}}`)},
+	}
+	set, err := lora_render.NewTemplateSet(lora_render.TemplateOptions{
+		Sources: []lora_render.TemplateSource{{FS: fsys, Layouts: []string{"layouts/*.html"}, Pages: []string{"pages/*.html"}}},
+		Funcs:   map[string]template.FuncMap{"index.html": {"upper": strings.ToUpper}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := executePage(t, set, "index.html", "amie"); got != "<title>index</title>AMIE" {
+		t.Fatalf("unexpected index %q", got)
+	}
+	if got := executePage(t, set, "about.html", nil); got != "<title>default</title>about" {
+		t.Fatalf("unexpected about %q", got)
+	}
+	if _, err := set.Lookup("missing.html"); err == nil {
+		t.Fatal("expected missing template error")
+	}
+}
+
+func TestTemplateSetDevReload(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(file, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	set, err := lora_render.NewTemplateSet(lora_render.TemplateOptions{
+		Sources: []lora_render.TemplateSource{{Pages: []string{filepath.Join(dir, "*.html")}}},
+		Dev:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := executePage(t, set, "index.html", nil); got != "v1" {
+		t.Fatalf("unexpected %q", got)
+	}
+	if err := os.WriteFile(file, []byte("v2"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(file, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if got := executePage(t, set, "index.html", nil); got != "v2" {
+		t.Fatalf("template not reloaded, got %q", got)
+	}
+}
+
+func TestHTMLRendererContext(t *testing.T) {
+	tmpl := template.Must(template.New("").Funcs(lora_render.ContextFuncMap(nil)).Parse(`{{define "page"}}{{.}}:{{ctx "csrf_token"}}{{end}}`))
+	renderer := lora_render.NewHtmlTemplateRender(tmpl)
+	cases := []struct {
+		rc   *lora_render.RenderContext
+		want string
+	}{
+		{nil, "amie:"},
+		{&lora_render.RenderContext{Values: map[string]any{"csrf_token": "<t>"}}, "amie:&lt;t&gt;"},
+		{&lora_render.RenderContext{Values: map[string]any{"csrf_token": "second"}}, "amie:second"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		if err := renderer.Instance("page", "amie", c.rc).Render(w, 200); err != nil {
+			t.Fatal(err)
+		}
+		if w.Body.String() != c.want {
+			t.Fatalf("got %q, want %q", w.Body.String(), c.want)
+		}
+	}
+	if err := renderer.Instance("missing", nil, nil).Render(httptest.NewRecorder(), 200); err == nil {
+		t.Fatal("expected missing template error")
+	}
+}
+
+// 并发渲染时每个请求只能看到自己的上下文，模板副本在请求之间复用
+func TestContextRenderConcurrent(t *testing.T) {
+	tmpl := template.Must(template.New("").Funcs(lora_render.ContextFuncMap(nil)).Parse(`{{define "page.html"}}{{.}}:{{ctx "user"}}{{end}}`))
+	set, err := lora_render.NewTemplateSet(lora_render.TemplateOptions{Sources: []lora_render.TemplateSource{{
+		FS:    fstest.MapFS{"page.html": {Data: []byte(`{{.}}:{{ctx "user"}}`)}},
+		Pages: []string{"*.html"},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	renderers := map[string]lora_render.HTMLRenderer{
+		"template": lora_render.NewHtmlTemplateRender(tmpl),
+		"set":      set,
+	}
+	for name, renderer := range renderers {
+		t.Run(name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					user := "u" + strconv.Itoa(i)
+					var rc *lora_render.RenderContext
+					want := user + ":"
+					if i%5 != 0 {
+						rc = &lora_render.RenderContext{Values: map[string]any{"user": user}}
+						want += user
+					}
+					for j := 0; j < 20; j++ {
+						w := httptest.NewRecorder()
+						if err := renderer.Instance("page.html", user, rc).Render(w, 200); err != nil {
+							t.Error(err)
+							return
+						}
+						if w.Body.String() != want {
+							t.Errorf("got %q, want %q", w.Body.String(), want)
+							return
+						}
+					}
+				}(i)
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestCSRFTemplateFuncs(t *testing.T) {
+	tmpl := template.Must(template.New("").Funcs(lora_render.ContextFuncMap(nil)).Parse(`{{define "form"}}{{csrfField}}|{{csrfToken}}{{end}}`))
+	renderer := lora_render.NewHtmlTemplateRender(tmpl)
+	rc := &lora_render.RenderContext{Values: map[string]any{
+		lora_render.CSRFTokenKey:     "abc",
+		lora_render.CSRFFieldNameKey: "_token",
+	}}
+	w := httptest.NewRecorder()
+	if err := renderer.Instance("form", nil, rc).Render(w, 200); err != nil {
+		t.Fatal(err)
+	}
+	if want := `<input type="hidden" name="_token" value="abc">|abc`; w.Body.String() != want {
+		t.Fatalf("got %q, want %q", w.Body.String(), want)
+	}
+}
@@ -0,0 +1,130 @@
+package router
+
+import (
+	"context"
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "192.168.1.10"}
+	cases := []struct {
+		name       string
+		trusted    []string
+		ipHeaders  []string
+		trustUnix  bool
+		unix       bool
+		remoteAddr string
+		headers    http.Header
+		want       string
+	}{
+		{name: "no trusted proxies", remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{"X-Forwarded-For": {"9.9.9.9"}}, want: "10.0.0.1"},
+		{name: "untrusted peer spoofs header", trusted: trusted, remoteAddr: "1.2.3.4:1234",
+			headers: http.Header{"X-Forwarded-For": {"9.9.9.9"}, "X-Real-Ip": {"8.8.8.8"}}, want: "1.2.3.4"},
+		{name: "trusted peer", trusted: trusted, remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{"X-Forwarded-For": {"9.9.9.9"}}, want: "9.9.9.9"},
+		{name: "single trusted ip", trusted: trusted, remoteAddr: "192.168.1.10:1234",
+			headers: http.Header{"X-Forwarded-For": {"9.9.9.9"}}, want: "9.9.9.9"},
+		{name: "right to left skips trusted proxies", trusted: trusted, remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{"X-Forwarded-For": {"6.6.6.6, 9.9.9.9, 10.0.0.2"}}, want: "9.9.9.9"},
+		{name: "all trusted uses leftmost", trusted: trusted, remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}}, want: "10.0.0.3"},
+		{name: "multiple headers are joined", trusted: trusted, remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{"X-Forwarded-For": {"6.6.6.6, 9.9.9.9", "10.0.0.2"}}, want: "9.9.9.9"},
+		{name: "invalid entry falls back to X-Real-IP", trusted: trusted, remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{"X-Forwarded-For": {"9.9.9.9, junk"}, "X-Real-Ip": {"8.8.8.8"}}, want: "8.8.8.8"},
+		{name: "invalid entry falls back to peer", trusted: trusted, remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{"X-Forwarded-For": {"junk"}}, want: "10.0.0.1"},
+		{name: "X-Real-IP", trusted: trusted, remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{"X-Real-Ip": {"8.8.8.8"}}, want: "8.8.8.8"},
+		{name: "CF-Connecting-IP ignored by default", trusted: trusted, remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{"Cf-Connecting-Ip": {"7.7.7.7"}}, want: "10.0.0.1"},
+		{name: "CF-Connecting-IP first", trusted: trusted, ipHeaders: []string{"CF-Connecting-IP", "X-Forwarded-For"}, remoteAddr: "10.0.0.1:1234",
+			headers: http.Header{"Cf-Connecting-Ip": {"7.7.7.7"}, "X-Forwarded-For": {"9.9.9.9"}}, want: "7.7.7.7"},
+		{name: "ipv6 peer", trusted: trusted, remoteAddr: "[2001:db8::1]:1234",
+			headers: http.Header{"X-Forwarded-For": {"9.9.9.9"}}, want: "2001:db8::1"},
+		{name: "unix socket not trusted", unix: true, remoteAddr: "@",
+			headers: http.Header{"X-Forwarded-For": {"9.9.9.9"}}, want: "@"},
+		{name: "unix socket trusted", trustUnix: true, unix: true, remoteAddr: "@",
+			headers: http.Header{"X-Forwarded-For": {"9.9.9.9"}}, want: "9.9.9.9"},
+		{name: "trusted unix setting ignores tcp peers", trustUnix: true, remoteAddr: "1.2.3.4:1234",
+			headers: http.Header{"X-Forwarded-For": {"9.9.9.9"}}, want: "1.2.3.4"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			engine := lora_router.New()
+			if err := engine.SetTrustedProxies(c.trusted); err != nil {
+				t.Fatal(err)
+			}
+			if c.ipHeaders != nil {
+				engine.SetRemoteIPHeaders(c.ipHeaders...)
+			}
+			engine.SetTrustUnixSocket(c.trustUnix)
+			var got string
+			engine.Group("ip").Get("/client", func(ctx *lora_router.Context) {
+				got = ctx.ClientIP()
+			})
+			r := httptest.NewRequest(http.MethodGet, "/ip/client", nil)
+			r.RemoteAddr = c.remoteAddr
+			r.Header = c.headers
+			if c.unix {
+				addr := &net.UnixAddr{Name: "/tmp/lora.sock", Net: "unix"}
+				r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, addr))
+			}
+			testutil.Serve(engine, r)
+			if got != c.want {
+				t.Fatalf("ClientIP %q, want %q", got, c.want)
+			}
+		})
+	}
+	if err := lora_router.New().SetTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Fatal("expected invalid proxy error")
+	}
+}
+
+// 通过真实的unix socket连接，RemoteAddr没有ip
+func TestClientIPOverUnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "lora")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "lora.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := lora_router.New()
+	engine.SetTrustUnixSocket(true)
+	engine.Group("ip").Get("/client", func(ctx *lora_router.Context) {
+		ctx.StringResponseWrite(http.StatusOK, "%s", ctx.ClientIP())
+	})
+	server := httptest.NewUnstartedServer(engine)
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	req, _ := http.NewRequest(http.MethodGet, "http://unix/ip/client", nil)
+	req.Header.Set("X-Forwarded-For", "9.9.9.9")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "9.9.9.9" {
+		t.Fatalf("ClientIP %q, want 9.9.9.9", body)
+	}
+}
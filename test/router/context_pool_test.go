@@ -0,0 +1,144 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"github.com/LorraineWen/lorago/lora_render"
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 从pool中复用的Context不能看到上一个请求的数据
+func TestPooledContextReset(t *testing.T) {
+	store := testutil.NewCookieStore(t)
+	engine := lora_router.New()
+	engine.SetHTMLRenderer(lora_render.NewHtmlTemplateRender(template.Must(
+		template.New("").Funcs(lora_render.ContextFuncMap(nil)).Parse(`{{define "page"}}[{{ctx "user"}}]{{end}}`))))
+	group := engine.Group("ctx")
+	group.Use((&lora_router.SessionEntity{Store: store}).SessionMiddleware)
+	seen := make(map[*lora_router.Context]bool)
+	reused := false
+	group.Post("/set/:id", func(ctx *lora_router.Context) {
+		seen[ctx] = true
+		ctx.BasicSet("user", "amie")
+		ctx.GetFormQuery("name")
+		ctx.SetTemplateValue("user", "amie")
+		ctx.Session().Set("user", "amie")
+		ctx.AddError(errors.New("first request failed"))
+		ctx.StringResponseWrite(http.StatusCreated, "created")
+	})
+	group.Get("/check", func(ctx *lora_router.Context) {
+		reused = reused || seen[ctx]
+		if ctx.StatusCode != 0 {
+			t.Errorf("StatusCode %d leaked", ctx.StatusCode)
+		}
+		if _, ok := ctx.BasicGet("user"); ok {
+			t.Error("keys leaked")
+		}
+		if name := ctx.GetFormQuery("name"); name != "" {
+			t.Errorf("form cache leaked %q", name)
+		}
+		if id := ctx.Param("id"); id != "" {
+			t.Errorf("params leaked %q", id)
+		}
+		if _, ok := ctx.Session().Get("user"); ok || !ctx.Session().IsNew() {
+			t.Error("session leaked")
+		}
+		if len(ctx.Errors()) != 0 {
+			t.Errorf("errors leaked %v", ctx.Errors())
+		}
+		if ctx.Err() != nil {
+			t.Errorf("Err should be nil while serving, got %v", ctx.Err())
+		}
+		ctx.TemplateResponseWrite(http.StatusOK, "page", nil)
+	})
+	for i := 0; i < 20; i++ {
+		form := url.Values{"name": {"amie"}}
+		r := httptest.NewRequest(http.MethodPost, "/ctx/set/7", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if w := testutil.Serve(engine, r); w.Code != http.StatusCreated {
+			t.Fatalf("set status %d", w.Code)
+		}
+		w := testutil.Serve(engine, httptest.NewRequest(http.MethodGet, "/ctx/check", nil))
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "amie") {
+			t.Fatalf("template values leaked: %d %q", w.Code, w.Body.String())
+		}
+	}
+	if !reused {
+		t.Skip("sync.Pool did not reuse a Context")
+	}
+}
+
+// handler内部的goroutine可以并发使用Context，handler返回之后的goroutine使用取出的请求context
+// 需要使用-race运行，Context放回pool之后不能再被读取
+func TestContextConcurrentUse(t *testing.T) {
+	engine := lora_router.New()
+	var background sync.WaitGroup
+	engine.Group("ctx").Get("/work", func(ctx *lora_router.Context) {
+		ctx.BasicSet("user", "amie")
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				select {
+				case <-ctx.Done():
+					t.Error("Done closed while serving")
+				default:
+				}
+				if ctx.Err() != nil || ctx.Value("user") != "amie" {
+					t.Errorf("unexpected context state %v %v", ctx.Err(), ctx.Value("user"))
+				}
+			}()
+		}
+		wg.Wait()
+		reqCtx := ctx.R.Context()
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			<-reqCtx.Done()
+			if !errors.Is(reqCtx.Err(), context.Canceled) {
+				t.Errorf("Err %v, want context.Canceled", reqCtx.Err())
+			}
+		}()
+		ctx.StringResponseWrite(http.StatusOK, "ok")
+	})
+	server := httptest.NewServer(engine)
+	defer server.Close()
+	var clients sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		clients.Add(1)
+		go func() {
+			defer clients.Done()
+			resp, err := server.Client().Get(server.URL + "/ctx/work")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status %d", resp.StatusCode)
+			}
+		}()
+	}
+	clients.Wait()
+	//请求结束之后net/http会取消请求的context，后台goroutine不会永远阻塞
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request context was not canceled after the request finished")
+	}
+}
@@ -0,0 +1,188 @@
+package router
+
+import (
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// GET /form/submit返回token，带上login参数时写入Session
+func submitHandler(ctx *lora_router.Context) {
+	if ctx.Session() != nil && ctx.R.URL.Query().Get("login") != "" {
+		ctx.Session().Set("user", ctx.R.URL.Query().Get("login"))
+	}
+	ctx.StringResponseWrite(http.StatusOK, "%s", ctx.CSRFToken())
+}
+
+type csrfRequest struct {
+	method  string
+	query   string
+	cookies []*http.Cookie
+	header  string //X-CSRF-Token
+	field   string //csrf_token表单字段
+}
+
+func doCSRF(engine *lora_router.Engine, req csrfRequest) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(req.method, "/form/submit?"+req.query, nil)
+	if req.field != "" {
+		r = testutil.NewFormRequest("/form/submit?"+req.query, url.Values{"csrf_token": {req.field}})
+	}
+	for _, cookie := range req.cookies {
+		r.AddCookie(cookie)
+	}
+	if req.header != "" {
+		r.Header.Set("X-CSRF-Token", req.header)
+	}
+	return testutil.Serve(engine, r)
+}
+
+// 合并两次响应的cookie，后面的覆盖前面的
+func mergeCookies(lists ...[]*http.Cookie) []*http.Cookie {
+	merged := make(map[string]*http.Cookie)
+	order := make([]string, 0)
+	for _, list := range lists {
+		for _, cookie := range list {
+			if _, ok := merged[cookie.Name]; !ok {
+				order = append(order, cookie.Name)
+			}
+			merged[cookie.Name] = cookie
+		}
+	}
+	ret := make([]*http.Cookie, 0, len(order))
+	for _, name := range order {
+		ret = append(ret, merged[name])
+	}
+	return ret
+}
+
+func cookiesNamed(cookies []*http.Cookie, name string) []*http.Cookie {
+	ret := make([]*http.Cookie, 0, 1)
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			ret = append(ret, cookie)
+		}
+	}
+	return ret
+}
+
+// 发起一次GET请求，返回token和cookie
+func fetchCSRF(t *testing.T, engine *lora_router.Engine, query string, cookies []*http.Cookie) (string, []*http.Cookie) {
+	t.Helper()
+	w := doCSRF(engine, csrfRequest{method: http.MethodGet, query: query, cookies: cookies})
+	if w.Code != http.StatusOK || w.Body.Len() == 0 {
+		t.Fatalf("GET status %d, token %q", w.Code, w.Body.String())
+	}
+	return w.Body.String(), mergeCookies(cookies, w.Result().Cookies())
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	engine := testutil.NewEngine("/form/submit", submitHandler, (&lora_router.CSRFEntity{Key: []byte("csrf-test-key")}).CSRFMiddleware)
+	token, cookies := fetchCSRF(t, engine, "", nil)
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("unexpected csrf cookie %v", cookies)
+	}
+	otherToken, otherCookies := fetchCSRF(t, engine, "", nil)
+	rawSecret, _, _ := strings.Cut(cookies[0].Value, ".")
+	unsigned := *cookies[0]
+	unsigned.Value = rawSecret
+	otherKeyToken, otherKeyCookies := fetchCSRF(t, testutil.NewEngine("/form/submit", submitHandler, (&lora_router.CSRFEntity{Key: []byte("another-key")}).CSRFMiddleware), "", nil)
+	cases := []struct {
+		name   string
+		req    csrfRequest
+		status int
+	}{
+		{"safe method without token", csrfRequest{method: http.MethodGet}, 200},
+		{"missing token", csrfRequest{method: http.MethodPost, cookies: cookies}, 403},
+		{"missing cookie", csrfRequest{method: http.MethodPost, header: token}, 403},
+		{"mismatched token", csrfRequest{method: http.MethodPost, cookies: cookies, header: otherToken}, 403},
+		{"mismatched cookie", csrfRequest{method: http.MethodPost, cookies: otherCookies, header: token}, 403},
+		{"masked header token", csrfRequest{method: http.MethodPost, cookies: cookies, header: token}, 200},
+		{"form field token", csrfRequest{method: http.MethodPost, cookies: cookies, field: token}, 200},
+		{"raw secret as token", csrfRequest{method: http.MethodPost, cookies: cookies, header: rawSecret}, 403},
+		{"unsigned cookie", csrfRequest{method: http.MethodPost, cookies: []*http.Cookie{&unsigned}, header: token}, 403},
+		{"cookie signed with another key", csrfRequest{method: http.MethodPost, cookies: otherKeyCookies, header: otherKeyToken}, 403},
+		{"garbage token", csrfRequest{method: http.MethodDelete, cookies: cookies, header: "!!"}, 403},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if w := doCSRF(engine, c.req); w.Code != c.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, c.status, w.Body.String())
+			}
+		})
+	}
+}
+
+// 有已经保存过的Session时cookie绑定session id，不能和其他会话一起使用
+func TestCSRFCookieBoundToSession(t *testing.T) {
+	store := testutil.NewCookieStore(t)
+	engine := testutil.NewEngine("/form/submit", submitHandler, (&lora_router.CSRFEntity{}).CSRFMiddleware, (&lora_router.SessionEntity{Store: store}).SessionMiddleware)
+	_, amie := fetchCSRF(t, engine, "login=amie", nil)
+	_, bob := fetchCSRF(t, engine, "login=bob", nil)
+	//登录之后重新获取绑定了会话的token
+	token, cookies := fetchCSRF(t, engine, "", cookiesNamed(amie, "lora_session"))
+	if w := doCSRF(engine, csrfRequest{method: http.MethodPost, cookies: cookies, header: token}); w.Code != http.StatusOK {
+		t.Fatalf("same session: status %d", w.Code)
+	}
+	transplanted := mergeCookies(cookiesNamed(bob, "lora_session"), cookiesNamed(cookies, "lora_csrf"))
+	if w := doCSRF(engine, csrfRequest{method: http.MethodPost, cookies: transplanted, header: token}); w.Code != http.StatusForbidden {
+		t.Fatalf("cookie from another session: status %d, want 403", w.Code)
+	}
+}
+
+// 第一次请求时Session是新创建的，GET返回的token和cookie在POST中仍然有效
+func TestCSRFCookieWithNewSession(t *testing.T) {
+	store := testutil.NewCookieStore(t)
+	engine := testutil.NewEngine("/form/submit", submitHandler, (&lora_router.CSRFEntity{}).CSRFMiddleware, (&lora_router.SessionEntity{Store: store}).SessionMiddleware)
+	for _, query := range []string{"login=amie", ""} {
+		token, cookies := fetchCSRF(t, engine, query, nil)
+		if len(cookiesNamed(cookies, "lora_session")) != 1 || len(cookiesNamed(cookies, "lora_csrf")) != 1 {
+			t.Fatalf("%q: unexpected cookies %v", query, cookies)
+		}
+		if w := doCSRF(engine, csrfRequest{method: http.MethodPost, cookies: cookies, header: token}); w.Code != http.StatusOK {
+			t.Fatalf("%q: status %d, want 200: %s", query, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestCSRFUseSession(t *testing.T) {
+	store := testutil.NewCookieStore(t)
+	engine := testutil.NewEngine("/form/submit", submitHandler, (&lora_router.CSRFEntity{UseSession: true}).CSRFMiddleware, (&lora_router.SessionEntity{Store: store}).SessionMiddleware)
+	token, cookies := fetchCSRF(t, engine, "", nil)
+	if len(cookiesNamed(cookies, "lora_csrf")) != 0 {
+		t.Fatal("session mode should not set the csrf cookie")
+	}
+	if w := doCSRF(engine, csrfRequest{method: http.MethodPost, cookies: cookies, field: token}); w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+	if w := doCSRF(engine, csrfRequest{method: http.MethodPost, field: token}); w.Code != http.StatusForbidden {
+		t.Fatalf("without session cookie: status %d, want 403", w.Code)
+	}
+}
+
+// UseSession为true但是没有会话中间件时拒绝所有需要验证的请求
+func TestCSRFUseSessionWithoutSession(t *testing.T) {
+	engine := testutil.NewEngine("/form/submit", submitHandler, (&lora_router.CSRFEntity{UseSession: true}).CSRFMiddleware)
+	token, cookies := fetchCSRF(t, engine, "", nil)
+	if len(cookies) != 0 {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+	if w := doCSRF(engine, csrfRequest{method: http.MethodPost, header: token}); w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want 403", w.Code)
+	}
+}
+
+func TestCSRFErrorFunc(t *testing.T) {
+	var reason any
+	csrf := &lora_router.CSRFEntity{ErrorFunc: func(ctx *lora_router.Context) {
+		reason, _ = ctx.BasicGet("csrf_reason")
+		ctx.StringResponseWrite(http.StatusTeapot, "blocked")
+	}}
+	engine := testutil.NewEngine("/form/submit", submitHandler, csrf.CSRFMiddleware)
+	if w := doCSRF(engine, csrfRequest{method: http.MethodPost}); w.Code != http.StatusTeapot || reason != "csrf token missing" {
+		t.Fatalf("status %d, reason %v", w.Code, reason)
+	}
+}
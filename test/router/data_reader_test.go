@@ -0,0 +1,144 @@
+package router
+
+import (
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const dataContent = "hello world"
+
+var dataModTime = time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+
+func TestDataFromReader(t *testing.T) {
+	modified := dataModTime.Format(http.TimeFormat)
+	cases := []struct {
+		name         string
+		method       string
+		length       int64
+		headers      map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{name: "full", status: 200, body: dataContent},
+		{name: "prefix", headers: map[string]string{"Range": "bytes=0-4"}, status: 206, body: "hello", contentRange: "bytes 0-4/11"},
+		{name: "open end", headers: map[string]string{"Range": "bytes=6-"}, status: 206, body: "world", contentRange: "bytes 6-10/11"},
+		{name: "suffix", headers: map[string]string{"Range": "bytes=-5"}, status: 206, body: "world", contentRange: "bytes 6-10/11"},
+		{name: "suffix larger than size", headers: map[string]string{"Range": "bytes=-50"}, status: 206, body: dataContent, contentRange: "bytes 0-10/11"},
+		{name: "end clamped", headers: map[string]string{"Range": "bytes=6-100"}, status: 206, body: "world", contentRange: "bytes 6-10/11"},
+		{name: "start past end", headers: map[string]string{"Range": "bytes=11-"}, status: 416, contentRange: "bytes */11"},
+		{name: "empty suffix", headers: map[string]string{"Range": "bytes=-0"}, status: 416, contentRange: "bytes */11"},
+		{name: "multiple ranges ignored", headers: map[string]string{"Range": "bytes=0-1,3-4"}, status: 200, body: dataContent},
+		{name: "malformed ignored", headers: map[string]string{"Range": "bytes=a-b"}, status: 200, body: dataContent},
+		{name: "reversed ignored", headers: map[string]string{"Range": "bytes=5-2"}, status: 200, body: dataContent},
+		{name: "other unit ignored", headers: map[string]string{"Range": "items=0-1"}, status: 200, body: dataContent},
+		{name: "if-range matches", headers: map[string]string{"Range": "bytes=0-4", "If-Range": modified}, status: 206, body: "hello", contentRange: "bytes 0-4/11"},
+		{name: "if-range stale", headers: map[string]string{"Range": "bytes=0-4", "If-Range": dataModTime.Add(-time.Hour).Format(http.TimeFormat)}, status: 200, body: dataContent},
+		{name: "if-range etag", headers: map[string]string{"Range": "bytes=0-4", "If-Range": `"v1"`}, status: 200, body: dataContent},
+		{name: "not modified", headers: map[string]string{"If-Modified-Since": modified}, status: 304},
+		{name: "modified since", headers: map[string]string{"If-Modified-Since": dataModTime.Add(-time.Second).Format(http.TimeFormat)}, status: 200, body: dataContent},
+		{name: "head", method: http.MethodHead, headers: map[string]string{"Range": "bytes=0-4"}, status: 206, contentRange: "bytes 0-4/11"},
+		{name: "unknown length ignores range", length: -1, headers: map[string]string{"Range": "bytes=0-4"}, status: 200, body: dataContent},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			length := int64(len(dataContent))
+			if c.length != 0 {
+				length = c.length
+			}
+			var recorded int
+			engine := lora_router.New()
+			engine.Group("files").Any("/report", func(ctx *lora_router.Context) {
+				err := ctx.DataFromReader(http.StatusOK, length, "text/plain", strings.NewReader(dataContent), lora_router.DataOptions{ModTime: dataModTime})
+				if err != nil {
+					t.Error(err)
+				}
+				recorded = ctx.StatusCode
+			})
+			method := c.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/files/report", nil)
+			for key, value := range c.headers {
+				r.Header.Set(key, value)
+			}
+			w := testutil.Serve(engine, r)
+			if w.Code != c.status || recorded != c.status {
+				t.Fatalf("status %d, ctx.StatusCode %d, want %d", w.Code, recorded, c.status)
+			}
+			if w.Body.String() != c.body {
+				t.Fatalf("body %q, want %q", w.Body.String(), c.body)
+			}
+			if got := w.Header().Get("Content-Range"); got != c.contentRange {
+				t.Fatalf("Content-Range %q, want %q", got, c.contentRange)
+			}
+			if c.status == http.StatusNotModified && w.Header().Get("Content-Type") != "" {
+				t.Fatal("304 should not carry Content-Type")
+			}
+		})
+	}
+}
+
+// ServeContent写入的状态码要记录到ctx.StatusCode中
+func TestDataFromReadSeekerStatus(t *testing.T) {
+	cases := []struct {
+		rangeHeader string
+		status      int
+	}{
+		{"", http.StatusOK},
+		{"bytes=0-4", http.StatusPartialContent},
+		{"bytes=20-", http.StatusRequestedRangeNotSatisfiable},
+	}
+	for _, c := range cases {
+		var recorded int
+		engine := lora_router.New()
+		engine.Group("files").Get("/report", func(ctx *lora_router.Context) {
+			ctx.DataFromReadSeeker("text/plain", strings.NewReader(dataContent), lora_router.DataOptions{ModTime: dataModTime})
+			recorded = ctx.StatusCode
+		})
+		r := httptest.NewRequest(http.MethodGet, "/files/report", nil)
+		if c.rangeHeader != "" {
+			r.Header.Set("Range", c.rangeHeader)
+		}
+		w := testutil.Serve(engine, r)
+		if w.Code != c.status || recorded != c.status {
+			t.Fatalf("range %q: status %d, ctx.StatusCode %d, want %d", c.rangeHeader, w.Code, recorded, c.status)
+		}
+	}
+}
+
+func TestStatusWriter(t *testing.T) {
+	cases := []struct {
+		name  string
+		write func(w http.ResponseWriter)
+		want  int
+	}{
+		{"no WriteHeader", func(w http.ResponseWriter) { w.Write([]byte("ok")) }, http.StatusOK},
+		{"WriteHeader", func(w http.ResponseWriter) { w.WriteHeader(http.StatusTeapot) }, http.StatusTeapot},
+		{"flush through ResponseController", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusAccepted)
+			if err := http.NewResponseController(w).Flush(); err != nil {
+				t.Errorf("flush: %v", err)
+			}
+		}, http.StatusAccepted},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			w := lora_router.NewStatusWriter(recorder)
+			c.write(w)
+			if w.Status != c.want || recorder.Code != c.want {
+				t.Fatalf("Status %d, recorder %d, want %d", w.Status, recorder.Code, c.want)
+			}
+			if w.Unwrap() != recorder {
+				t.Fatal("Unwrap should return the original ResponseWriter")
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package router
+
+import (
+	"errors"
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 测试用的国家代码查询，不在表中的ip查询失败
+type fakeCountries map[string]string
+
+func (f fakeCountries) Country(ip net.IP) (string, error) {
+	if country, ok := f[ip.String()]; ok {
+		return country, nil
+	}
+	return "", errors.New("ip not found in database")
+}
+
+func panelHandler(ctx *lora_router.Context) {
+	ctx.StringResponseWrite(http.StatusOK, "ok")
+}
+
+func filterStatus(engine *lora_router.Engine, ip string) int {
+	r := httptest.NewRequest(http.MethodGet, "/admin/panel", nil)
+	r.RemoteAddr = net.JoinHostPort(ip, "1234")
+	return testutil.Serve(engine, r).Code
+}
+
+func TestIPFilterRules(t *testing.T) {
+	countries := fakeCountries{"1.1.1.1": "cn", "2.2.2.2": "US", "10.0.0.7": "US"}
+	cases := []struct {
+		name      string
+		rules     lora_router.IPFilterRules
+		countries lora_router.CountryLookup
+		ip        string
+		status    int
+	}{
+		{"empty rules allow all", lora_router.IPFilterRules{}, nil, "1.2.3.4", 200},
+		{"allow list", lora_router.IPFilterRules{Allow: []string{"10.0.0.0/8"}}, nil, "10.0.0.1", 200},
+		{"not in allow list", lora_router.IPFilterRules{Allow: []string{"10.0.0.0/8"}}, nil, "1.2.3.4", 403},
+		{"deny before allow", lora_router.IPFilterRules{Allow: []string{"10.0.0.0/8"}, Deny: []string{"10.0.0.13"}}, nil, "10.0.0.13", 403},
+		{"deny only", lora_router.IPFilterRules{Deny: []string{"10.0.0.13"}}, nil, "1.2.3.4", 200},
+		{"ipv6 allow", lora_router.IPFilterRules{Allow: []string{"2001:db8::/32"}}, nil, "2001:db8::1", 200},
+		{"allow country", lora_router.IPFilterRules{AllowCountries: []string{"CN"}}, countries, "1.1.1.1", 200},
+		{"country not allowed", lora_router.IPFilterRules{AllowCountries: []string{"CN"}}, countries, "2.2.2.2", 403},
+		{"ip allow without country", lora_router.IPFilterRules{Allow: []string{"3.3.3.3"}, AllowCountries: []string{"CN"}}, countries, "3.3.3.3", 200},
+		{"deny country before allow ip", lora_router.IPFilterRules{Allow: []string{"10.0.0.0/8"}, DenyCountries: []string{"us"}}, countries, "10.0.0.7", 403},
+		{"deny country only", lora_router.IPFilterRules{DenyCountries: []string{"US"}}, countries, "1.1.1.1", 200},
+		{"lookup failure with allow countries", lora_router.IPFilterRules{AllowCountries: []string{"CN"}}, countries, "4.4.4.4", 403},
+		{"lookup failure with deny countries", lora_router.IPFilterRules{DenyCountries: []string{"US"}}, countries, "4.4.4.4", 200},
+		{"lookup not configured", lora_router.IPFilterRules{AllowCountries: []string{"CN"}}, nil, "1.1.1.1", 403},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			engine := testutil.NewEngine("/admin/panel", panelHandler, (&lora_router.IPFilterEntity{Rules: c.rules, Countries: c.countries}).IPFilterMiddleware)
+			if got := filterStatus(engine, c.ip); got != c.status {
+				t.Fatalf("status %d, want %d", got, c.status)
+			}
+		})
+	}
+}
+
+func TestIPFilterBlockedFunc(t *testing.T) {
+	var reason any
+	filter := &lora_router.IPFilterEntity{
+		Rules: lora_router.IPFilterRules{Deny: []string{"1.2.3.4"}},
+		BlockedFunc: func(ctx *lora_router.Context) {
+			reason, _ = ctx.BasicGet("ip_filter_reason")
+			ctx.StringResponseWrite(http.StatusTeapot, "blocked")
+		},
+	}
+	if got := filterStatus(testutil.NewEngine("/admin/panel", panelHandler, filter.IPFilterMiddleware), "1.2.3.4"); got != http.StatusTeapot || reason == nil {
+		t.Fatalf("status %d, reason %v", got, reason)
+	}
+}
+
+func writeRules(t *testing.T, file, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 规则加载失败时拒绝所有请求，规则文件出现之后恢复
+func TestIPFilterFailClosed(t *testing.T) {
+	engine := testutil.NewEngine("/admin/panel", panelHandler, (&lora_router.IPFilterEntity{Rules: lora_router.IPFilterRules{Allow: []string{"not-a-cidr"}}}).IPFilterMiddleware)
+	if got := filterStatus(engine, "10.0.0.1"); got != http.StatusForbidden {
+		t.Fatalf("invalid rules: status %d, want 403", got)
+	}
+
+	file := filepath.Join(t.TempDir(), "ip_filter.toml")
+	filter := &lora_router.IPFilterEntity{File: file, ReloadInterval: time.Millisecond}
+	engine = testutil.NewEngine("/admin/panel", panelHandler, filter.IPFilterMiddleware)
+	if got := filterStatus(engine, "10.0.0.1"); got != http.StatusForbidden {
+		t.Fatalf("missing file: status %d, want 403", got)
+	}
+	writeRules(t, file, `allow = ["10.0.0.0/8"]`, time.Now())
+	time.Sleep(5 * time.Millisecond)
+	if got := filterStatus(engine, "10.0.0.1"); got != http.StatusOK {
+		t.Fatalf("rules should load once the file exists, status %d", got)
+	}
+	if got := filterStatus(engine, "1.2.3.4"); got != http.StatusForbidden {
+		t.Fatalf("status %d, want 403", got)
+	}
+}
+
+func TestIPFilterHotReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ip_filter.toml")
+	modTime := time.Now().Add(-time.Hour)
+	writeRules(t, file, `allow = ["1.2.3.4"]`, modTime)
+	filter := &lora_router.IPFilterEntity{File: file, ReloadInterval: time.Millisecond}
+	engine := testutil.NewEngine("/admin/panel", panelHandler, filter.IPFilterMiddleware)
+	if got := filterStatus(engine, "1.2.3.4"); got != http.StatusOK {
+		t.Fatalf("status %d, want 200", got)
+	}
+	modTime = modTime.Add(time.Minute)
+	writeRules(t, file, `deny = ["1.2.3.4"]`, modTime)
+	time.Sleep(5 * time.Millisecond)
+	if got := filterStatus(engine, "1.2.3.4"); got != http.StatusForbidden {
+		t.Fatalf("reloaded rules should deny, status %d", got)
+	}
+	//文件格式错误时继续使用旧的规则
+	modTime = modTime.Add(time.Minute)
+	writeRules(t, file, `deny = [`, modTime)
+	time.Sleep(5 * time.Millisecond)
+	if got := filterStatus(engine, "1.2.3.4"); got != http.StatusForbidden {
+		t.Fatalf("broken file should keep the old rules, status %d", got)
+	}
+	if got := filterStatus(engine, "5.6.7.8"); got != http.StatusOK {
+		t.Fatalf("status %d, want 200", got)
+	}
+}
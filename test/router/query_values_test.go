@@ -0,0 +1,194 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func checkParamErr(t *testing.T, err error, wantValue string, missing bool) {
+	t.Helper()
+	var paramErr *lora_router.ParamError
+	if !errors.As(err, &paramErr) {
+		t.Fatalf("expected ParamError, got %v", err)
+	}
+	if missing != errors.Is(err, lora_router.ErrMissingParam) {
+		t.Fatalf("missing %v, got %v", missing, err)
+	}
+	if paramErr.Value != wantValue {
+		t.Fatalf("ParamError.Value %q, want %q", paramErr.Value, wantValue)
+	}
+}
+
+func TestTypedQueryGetters(t *testing.T) {
+	cases := []struct {
+		query   string
+		get     func(ctx *lora_router.Context) (any, error)
+		want    any
+		invalid string //不为空表示转换失败时ParamError中的值
+		missing bool
+	}{
+		{"page=2", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryInt("page") }, 2, "", false},
+		{"page=x", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryInt("page") }, nil, "x", false},
+		{"", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryInt("page") }, nil, "", true},
+		{"agree=on", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryBool("agree") }, true, "", false},
+		{"agree=false", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryBool("agree") }, false, "", false},
+		{"agree=1", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryBool("agree") }, true, "", false},
+		{"agree=yes", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryBool("agree") }, nil, "yes", false},
+		{"price=1.5", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryFloat("price") }, 1.5, "", false},
+		{"price=1,5", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryFloat("price") }, nil, "1,5", false},
+		{"id=1&id=2", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryIntSlice("id") }, []int{1, 2}, "", false},
+		{"id=1&id=x", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryIntSlice("id") }, nil, "x", false},
+		{"flag=on&flag=0", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryBoolSlice("flag") }, []bool{true, false}, "", false},
+		{"p=0.5&p=2", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryFloatSlice("p") }, []float64{0.5, 2}, "", false},
+		{"", func(ctx *lora_router.Context) (any, error) { return ctx.GetQueryFloatSlice("p") }, nil, "", true},
+	}
+	for _, c := range cases {
+		testutil.Handle(httptest.NewRequest(http.MethodGet, "/q/values?"+c.query, nil), func(ctx *lora_router.Context) {
+			got, err := c.get(ctx)
+			if c.invalid != "" || c.missing {
+				checkParamErr(t, err, c.invalid, c.missing)
+				return
+			}
+			if err != nil {
+				t.Fatalf("%q: %v", c.query, err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("%q: got %v, want %v", c.query, got, c.want)
+			}
+		})
+	}
+}
+
+func TestQueryTimeLayouts(t *testing.T) {
+	cases := []struct {
+		value  string
+		layout string
+		want   time.Time
+		ok     bool
+	}{
+		{"2024-01-02T15:04:05Z", "", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC), true},
+		{"2024-01-02", "", time.Time{}, false},
+		{"2024-01-02", "2006-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local), true},
+		{"1704207845", "unix", time.Unix(1704207845, 0), true},
+		{"1704207845000000001", "unixnano", time.Unix(1704207845, 1), true},
+		{"soon", "unix", time.Time{}, false},
+	}
+	for _, c := range cases {
+		testutil.Handle(httptest.NewRequest(http.MethodGet, "/q/values?since="+url.QueryEscape(c.value), nil), func(ctx *lora_router.Context) {
+			got, err := ctx.GetQueryTime("since", c.layout)
+			if !c.ok {
+				checkParamErr(t, err, c.value, false)
+				return
+			}
+			if err != nil || !got.Equal(c.want) {
+				t.Fatalf("%q with layout %q: got %v, %v, want %v", c.value, c.layout, got, err, c.want)
+			}
+			slice, err := ctx.GetQueryTimeSlice("since", c.layout)
+			if err != nil || len(slice) != 1 || !slice[0].Equal(c.want) {
+				t.Fatalf("slice %q: got %v, %v", c.value, slice, err)
+			}
+		})
+	}
+}
+
+func TestDefaultQueryValues(t *testing.T) {
+	testutil.Handle(httptest.NewRequest(http.MethodGet, "/q/values?page=x&size=20", nil), func(ctx *lora_router.Context) {
+		if got := ctx.DefaultQueryInt("page", 1); got != 1 {
+			t.Fatalf("invalid value should use default, got %d", got)
+		}
+		if got := ctx.DefaultQueryInt("size", 10); got != 20 {
+			t.Fatalf("got %d, want 20", got)
+		}
+		if got := ctx.DefaultQueryBool("missing", true); !got {
+			t.Fatal("missing value should use default")
+		}
+		since := time.Unix(1, 0)
+		if got := ctx.DefaultQueryTime("since", "unix", since); !got.Equal(since) {
+			t.Fatalf("got %v", got)
+		}
+	})
+}
+
+// 表单中没有value的复选框提交on，query中的同名参数不影响表单参数
+func TestFormQueryGetters(t *testing.T) {
+	form := url.Values{"agree": {"on"}, "age": {"18"}, "tag": {"1", "2"}}
+	testutil.Handle(testutil.NewFormRequest("/q/values?age=x", form), func(ctx *lora_router.Context) {
+		if agree, err := ctx.GetFormQueryBool("agree"); err != nil || !agree {
+			t.Fatalf("checkbox on: got %v, %v", agree, err)
+		}
+		if age, err := ctx.GetFormQueryInt("age"); err != nil || age != 18 {
+			t.Fatalf("age: got %d, %v", age, err)
+		}
+		if tags := ctx.DefaultFormQueryIntSlice("tag", nil); !reflect.DeepEqual(tags, []int{1, 2}) {
+			t.Fatalf("tags: got %v", tags)
+		}
+		if got := ctx.DefaultFormQueryFloat("price", 9.9); got != 9.9 {
+			t.Fatalf("price: got %v", got)
+		}
+	})
+}
+
+func TestParamErrorReturns400(t *testing.T) {
+	w := testutil.Handle(httptest.NewRequest(http.MethodGet, "/q/values?page=abc", nil), func(ctx *lora_router.Context) {
+		if _, err := ctx.GetQueryInt("page"); err != nil {
+			ctx.ErrorHandle(err)
+		}
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", w.Code)
+	}
+	var body struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != http.StatusBadRequest || !strings.Contains(body.Msg, "page") {
+		t.Fatalf("unexpected body %+v", body)
+	}
+}
+
+func TestNestedMap(t *testing.T) {
+	cases := []struct {
+		query string
+		key   string
+		want  map[string]any
+		ok    bool
+	}{
+		{"user[name]=amie&user[address][city]=beijing", "user",
+			map[string]any{"name": "amie", "address": map[string]any{"city": "beijing"}}, true},
+		{"user[a]=1&user[a][b]=2", "user", map[string]any{"a": map[string]any{"b": "2"}}, true},
+		{"user[a][b]=2&user[a]=1", "user", map[string]any{"a": map[string]any{"b": "2"}}, true},
+		{"user[a][]=1&user[a][b]=2", "user", map[string]any{"a": map[string]any{"b": "2"}}, true},
+		{"user[tags][]=a&user[tags][]=b", "user", map[string]any{"tags": []string{"a", "b"}}, true},
+		{"user[role]=admin&user[role]=dev", "user", map[string]any{"role": []string{"admin", "dev"}}, true},
+		{"user=amie&other[name]=x", "user", map[string]any{}, false},
+		{"user[name=amie&[name]=x", "user", map[string]any{}, false},
+		{"a[x]=1&b=2", "", map[string]any{"a": map[string]any{"x": "1"}, "b": "2"}, true},
+	}
+	for _, c := range cases {
+		testutil.Handle(httptest.NewRequest(http.MethodGet, "/q/values?"+c.query, nil), func(ctx *lora_router.Context) {
+			got, ok := ctx.GetQueryNestedMap(c.key)
+			if ok != c.ok || !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("%q: got %#v, %v, want %#v, %v", c.query, got, ok, c.want, c.ok)
+			}
+		})
+	}
+	form := url.Values{"user[tags][]": {"a"}, "user[name]": {"amie"}}
+	testutil.Handle(testutil.NewFormRequest("/q/values", form), func(ctx *lora_router.Context) {
+		got, ok := ctx.GetFormQueryNestedMap("user")
+		if want := map[string]any{"tags": []string{"a"}, "name": "amie"}; !ok || !reflect.DeepEqual(got, want) {
+			t.Fatalf("form: got %#v, %v", got, ok)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/LorraineWen/lorago/lora_render"
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamStopsOnDisconnect(t *testing.T) {
+	engine := lora_router.New()
+	messages := make(chan string)
+	result := make(chan bool, 1)
+	engine.Group("events").Get("/stream", func(ctx *lora_router.Context) {
+		result <- ctx.Stream(func(reqCtx context.Context, w io.Writer) bool {
+			select {
+			case <-reqCtx.Done():
+				return false
+			case msg := <-messages:
+				ctx.SSE(lora_render.SSEvent{Data: msg})
+				return true
+			}
+		})
+	})
+	server := httptest.NewServer(engine)
+	defer server.Close()
+
+	reqCtx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(reqCtx, http.MethodGet, server.URL+"/events/stream", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	messages <- "hello"
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "data: hello" {
+		t.Fatalf("unexpected first event %q, %v", line, err)
+	}
+	//step阻塞在等待消息时断开连接，Stream应该立即结束
+	cancel()
+	select {
+	case disconnected := <-result:
+		if !disconnected {
+			t.Fatal("Stream should report the client disconnect")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stream did not notice the client disconnect while step was blocked")
+	}
+}
+
+type bindUser struct {
+	Name string `json:"name" form:"name" binding:"required"`
+}
+
+func TestBindWritesErrorStatus(t *testing.T) {
+	engine := lora_router.New()
+	engine.Group("user").Any("/add", func(ctx *lora_router.Context) {
+		ctx.Validate = true
+		user := &bindUser{}
+		if err := ctx.Bind(user); err != nil {
+			return
+		}
+		ctx.StringResponseWrite(http.StatusOK, "%s", user.Name)
+	})
+	cases := []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		{"application/json", `{"name": "amie"}`, http.StatusOK},
+		{"application/json", `{"name": `, http.StatusBadRequest},
+		{"application/json", `{}`, http.StatusUnprocessableEntity},
+		{"application/x-www-form-urlencoded", `name=amie`, http.StatusOK},
+		{"application/x-www-form-urlencoded", `age=1`, http.StatusUnprocessableEntity},
+		{"application/unknown", `name=amie`, http.StatusUnsupportedMediaType},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodPost, "/user/add", strings.NewReader(c.body))
+		r.Header.Set("Content-Type", c.contentType)
+		if w := testutil.Serve(engine, r); w.Code != c.status {
+			t.Fatalf("%s %s: got %d %q, want %d", c.contentType, c.body, w.Code, w.Body.String(), c.status)
+		}
+	}
+	//GET请求绑定请求路径参数，required的检查和json，表单一致
+	for query, status := range map[string]int{"name=amie": http.StatusOK, "age=1": http.StatusUnprocessableEntity} {
+		if w := testutil.Serve(engine, httptest.NewRequest(http.MethodGet, "/user/add?"+query, nil)); w.Code != status {
+			t.Fatalf("GET %s: got %d %q, want %d", query, w.Code, w.Body.String(), status)
+		}
+	}
+}
+
+func TestShouldBindDoesNotWrite(t *testing.T) {
+	engine := lora_router.New()
+	engine.Group("user").Post("/add", func(ctx *lora_router.Context) {
+		if err := ctx.ShouldBind(&bindUser{}); err != nil {
+			ctx.StringResponseWrite(http.StatusTeapot, "custom")
+		}
+	})
+	r := httptest.NewRequest(http.MethodPost, "/user/add", strings.NewReader("{"))
+	r.Header.Set("Content-Type", "application/json")
+	if w := testutil.Serve(engine, r); w.Code != http.StatusTeapot || w.Body.String() != "custom" {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+}
+
+// 上传一个1KB的文件，返回文件是否被存放到了临时文件中
+func uploadedToDisk(t *testing.T, engine *lora_router.Engine) bool {
+	onDisk := make(chan bool, 1)
+	engine.Group("file").Post("/upload", func(ctx *lora_router.Context) {
+		form := &struct {
+			File *multipart.FileHeader `form:"file"`
+		}{}
+		if err := ctx.BindForm(form); err != nil {
+			t.Error(err)
+			return
+		}
+		f, err := form.File.Open()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer f.Close()
+		_, isFile := f.(*os.File)
+		onDisk <- isFile
+	})
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "a.txt")
+	part.Write(bytes.Repeat([]byte("a"), 1024))
+	writer.Close()
+	r := httptest.NewRequest(http.MethodPost, "/file/upload", body)
+	r.Header.Set("Content-Type", writer.FormDataContentType())
+	testutil.Serve(engine, r)
+	return <-onDisk
+}
+
+func TestMaxMultipartMemory(t *testing.T) {
+	if uploadedToDisk(t, lora_router.New()) {
+		t.Fatal("a small file should stay in memory with the default limit")
+	}
+	engine := lora_router.New()
+	engine.SetMaxMultipartMemory(512)
+	if !uploadedToDisk(t, engine) {
+		t.Fatal("SetMaxMultipartMemory was ignored by the form binder")
+	}
+}
+
+func TestNegotiateEscapesHTMLFallback(t *testing.T) {
+	engine := lora_router.New()
+	engine.Group("user").Get("/name", func(ctx *lora_router.Context) {
+		ctx.Negotiate(http.StatusOK, ctx.GetQuery("name"), lora_render.MIMEJSON, lora_render.MIMEHTML)
+	})
+	r := httptest.NewRequest(http.MethodGet, "/user/name?name=%3Cscript%3Ealert(1)%3C/script%3E", nil)
+	r.Header.Set("Accept", "text/html")
+	w := testutil.Serve(engine, r)
+	if strings.Contains(w.Body.String(), "<script>") || w.Body.String() != "&lt;script&gt;alert(1)&lt;/script&gt;" {
+		t.Fatalf("html fallback was not escaped: %q", w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, lora_render.MIMEHTML) {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+}
+
+// 都不匹配时写入406，SetNegotiateDefault设置的格式没有Render时同样返回406
+func TestNegotiateNotAcceptable(t *testing.T) {
+	cases := []struct {
+		negotiateDefault string
+		accept           string
+		status           int
+	}{
+		{"", "application/json", http.StatusOK},
+		{"", "image/png", http.StatusNotAcceptable},
+		{lora_render.MIMEJSON, "image/png", http.StatusOK},
+		{"application/x-unknown", "image/png", http.StatusNotAcceptable},
+	}
+	for _, c := range cases {
+		engine := lora_router.New()
+		engine.SetNegotiateDefault(c.negotiateDefault)
+		var err error
+		engine.Group("user").Get("/info", func(ctx *lora_router.Context) {
+			err = ctx.Negotiate(http.StatusOK, "amie", lora_render.MIMEJSON, lora_render.MIMEXML)
+		})
+		r := httptest.NewRequest(http.MethodGet, "/user/info", nil)
+		r.Header.Set("Accept", c.accept)
+		if w := testutil.Serve(engine, r); w.Code != c.status || (c.status == http.StatusNotAcceptable) != errors.Is(err, lora_render.ErrNotAcceptable) {
+			t.Fatalf("%q %q: got %d %v, want %d", c.negotiateDefault, c.accept, w.Code, err, c.status)
+		}
+	}
+	//不是engine创建的Context没有默认格式
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/user/info", nil)
+	r.Header.Set("Accept", "image/png")
+	ctx := &lora_router.Context{W: w, R: r}
+	if err := ctx.Negotiate(http.StatusOK, "amie"); !errors.Is(err, lora_render.ErrNotAcceptable) || w.Code != http.StatusNotAcceptable {
+		t.Fatalf("got %d %v", w.Code, err)
+	}
+}
+
+// 先写入size字节的数据，再返回err
+type partialRender struct {
+	size int
+	err  error
+}
+
+func (p *partialRender) Render(w http.ResponseWriter, status int) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(bytes.Repeat([]byte("a"), p.size))
+	return p.err
+}
+
+func TestRenderErrorReturns500(t *testing.T) {
+	logged := ""
+	engine := testutil.NewEngine("/render/data", func(ctx *lora_router.Context) {
+		ctx.JsonResponseWrite(http.StatusOK, map[string]any{"ch": make(chan int)})
+	}, testutil.LogError(&logged))
+	w := testutil.Serve(engine, httptest.NewRequest(http.MethodGet, "/render/data", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+	//返回给客户端的错误信息中不包含内部的错误
+	if w.Body.String() != "{\"code\":500,\"msg\":\"Internal Server Error\"}\n" {
+		t.Fatalf("unexpected body %q", w.Body.String())
+	}
+	if !strings.HasPrefix(logged, "Error: render *lora_render.JsonRender failed: json: unsupported type: chan int") {
+		t.Fatalf("render error was not logged: %q", logged)
+	}
+}
+
+func TestRenderErrorDiscardsBufferedBody(t *testing.T) {
+	logged := ""
+	engine := testutil.NewEngine("/render/data", func(ctx *lora_router.Context) {
+		ctx.Render(http.StatusOK, &partialRender{size: 100, err: errors.New("template: missing key")})
+	}, testutil.LogError(&logged))
+	w := testutil.Serve(engine, httptest.NewRequest(http.MethodGet, "/render/data", nil))
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "aaa") || strings.Contains(w.Body.String(), "template") {
+		t.Fatalf("got %d %q", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logged, "template: missing key") {
+		t.Fatalf("render error was not logged: %q", logged)
+	}
+}
+
+func TestRenderStreamsLargeBody(t *testing.T) {
+	logged := ""
+	engine := testutil.NewEngine("/render/data", func(ctx *lora_router.Context) {
+		ctx.Render(http.StatusOK, &partialRender{size: 4096, err: errors.New("connection reset")})
+	}, testutil.LogError(&logged))
+	engine.SetRenderBufferSize(1024)
+	w := testutil.Serve(engine, httptest.NewRequest(http.MethodGet, "/render/data", nil))
+	//超过缓冲区大小的响应已经写给了客户端，失败之后只能记录到日志中
+	if w.Code != http.StatusOK || w.Body.Len() != 4096 {
+		t.Fatalf("got %d with %d bytes", w.Code, w.Body.Len())
+	}
+	if !strings.Contains(logged, "connection reset") {
+		t.Fatalf("render error was not logged: %q", logged)
+	}
+
+	engine = testutil.NewEngine("/render/data", func(ctx *lora_router.Context) {
+		ctx.JsonResponseWrite(http.StatusCreated, strings.Repeat("a", 4096))
+	}, testutil.LogError(&logged))
+	engine.SetRenderBufferSize(-1)
+	if w = testutil.Serve(engine, httptest.NewRequest(http.MethodGet, "/render/data", nil)); w.Code != http.StatusCreated || w.Body.Len() != 4099 {
+		t.Fatalf("unbuffered: got %d with %d bytes", w.Code, w.Body.Len())
+	}
+}
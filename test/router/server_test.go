@@ -0,0 +1,74 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"golang.org/x/net/http2"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func helloHandler(ctx *lora_router.Context) {
+	ctx.StringResponseWrite(http.StatusOK, "%s", ctx.R.Proto)
+}
+
+func TestH2C(t *testing.T) {
+	engine := testutil.NewEngine("/api/hello", helloHandler)
+	engine.EnableH2C()
+	server := httptest.NewServer(engine.Handler())
+	defer server.Close()
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get(server.URL + "/api/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.ProtoMajor != 2 || string(body) != "HTTP/2.0" {
+		t.Fatalf("expected an h2c response, got %s %q", resp.Proto, body)
+	}
+}
+
+func TestRunUnix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "lora")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "lora.sock")
+	go testutil.NewEngine("/api/hello", helloHandler).RunUnix(socket)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		resp, err := client.Get("http://unix/api/hello")
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != "HTTP/1.1" {
+				t.Fatalf("unexpected body %q", body)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,71 @@
+package router
+
+import (
+	"bufio"
+	"errors"
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago/lora_session"
+	"github.com/LorraineWen/lorago_test/testutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 保存失败时响应照常返回，错误记录到日志中
+func TestSessionSaveErrorLogged(t *testing.T) {
+	logged := ""
+	engine := testutil.NewEngine("/session/big", func(ctx *lora_router.Context) {
+		ctx.Session().Set("data", strings.Repeat("x", 5000))
+		ctx.StringResponseWrite(http.StatusOK, "ok")
+	}, testutil.LogError(&logged), (&lora_router.SessionEntity{Store: testutil.NewCookieStore(t)}).SessionMiddleware)
+	w := testutil.Serve(engine, httptest.NewRequest(http.MethodGet, "/session/big", nil))
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("status %d, cookies %v", w.Code, w.Result().Cookies())
+	}
+	if !strings.Contains(logged, lora_session.ErrCookieTooLarge.Error()) {
+		t.Fatalf("save error not logged: %q", logged)
+	}
+}
+
+// websocket等协议升级时需要通过http.Hijacker接管连接
+func TestSessionWriterHijack(t *testing.T) {
+	logged := ""
+	hijacked := make(chan error, 1)
+	engine := testutil.NewEngine("/session/upgrade", func(ctx *lora_router.Context) {
+		ctx.Session().Set("user", "amie")
+		hijacker, ok := ctx.W.(http.Hijacker)
+		if !ok {
+			hijacked <- errors.New("session writer does not implement http.Hijacker")
+			return
+		}
+		conn, rw, err := hijacker.Hijack()
+		if err != nil {
+			hijacked <- err
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\nhello")
+		rw.Flush()
+		hijacked <- nil
+	}, testutil.LogError(&logged), (&lora_router.SessionEntity{Store: testutil.NewCookieStore(t)}).SessionMiddleware)
+	server := httptest.NewServer(engine)
+	defer server.Close()
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /session/upgrade HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n"))
+	if err := <-hijacked; err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("status %d, want 101", resp.StatusCode)
+	}
+}
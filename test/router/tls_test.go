@@ -0,0 +1,185 @@
+package router
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/LorraineWen/lorago/lora_router"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	cases := []struct {
+		tlsAddr string
+		target  string
+		want    string
+	}{
+		{":443", "http://example.com/user?id=1", "https://example.com/user?id=1"},
+		{":443", "http://example.com:80/user", "https://example.com/user"},
+		{":8443", "http://example.com:8080/user", "https://example.com:8443/user"},
+		{"0.0.0.0:8443", "http://127.0.0.1/", "https://127.0.0.1:8443/"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		lora_router.HTTPSRedirectHandler(c.tlsAddr).ServeHTTP(w, httptest.NewRequest(http.MethodPost, c.target, nil))
+		if w.Code != http.StatusPermanentRedirect {
+			t.Fatalf("%s: unexpected status %d", c.target, w.Code)
+		}
+		if location := w.Header().Get("Location"); location != c.want {
+			t.Fatalf("%s: got %q, want %q", c.target, location, c.want)
+		}
+	}
+}
+
+// 生成自签名证书写入dir，返回证书和私钥文件
+func writeCert(t *testing.T, dir, name string, serial int64, modTime time.Time) lora_router.CertKeyPair {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair := lora_router.CertKeyPair{CertFile: filepath.Join(dir, name+".crt"), KeyFile: filepath.Join(dir, name+".key")}
+	writeFile(t, pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), modTime)
+	writeFile(t, pair.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), modTime)
+	return pair
+}
+
+func writeFile(t *testing.T, file string, data []byte, modTime time.Time) {
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func helloFor(serverName string) *tls.ClientHelloInfo {
+	return &tls.ClientHelloInfo{
+		ServerName:        serverName,
+		SupportedVersions: []uint16{tls.VersionTLS13},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256},
+		SupportedCurves:   []tls.CurveID{tls.CurveP256},
+	}
+}
+
+func servedSerial(t *testing.T, reloader *lora_router.CertReloader, serverName string) int64 {
+	cert, err := reloader.GetCertificate(helloFor(serverName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.SerialNumber.Int64()
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	a := writeCert(t, dir, "a.example.com", 1, start)
+	b := writeCert(t, dir, "b.example.com", 2, start)
+	reloader, err := lora_router.NewCertReloader([]lora_router.CertKeyPair{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//根据SNI选择证书，都不匹配时使用第一个
+	if serial := servedSerial(t, reloader, "b.example.com"); serial != 2 {
+		t.Fatalf("sni b: got serial %d", serial)
+	}
+	if serial := servedSerial(t, reloader, "other.example.com"); serial != 1 {
+		t.Fatalf("unknown sni: got serial %d", serial)
+	}
+	if reloaded, err := reloader.Reload(); err != nil || reloaded {
+		t.Fatalf("unchanged files should not reload: %v, %v", reloaded, err)
+	}
+	//证书续期之后重新加载
+	writeCert(t, dir, "a.example.com", 3, start.Add(time.Minute))
+	if reloaded, err := reloader.Reload(); err != nil || !reloaded {
+		t.Fatalf("renewed certificate should reload: %v, %v", reloaded, err)
+	}
+	if serial := servedSerial(t, reloader, "a.example.com"); serial != 3 {
+		t.Fatalf("renewed: got serial %d", serial)
+	}
+	//新证书损坏时继续使用旧的证书
+	writeFile(t, a.CertFile, []byte("broken"), start.Add(2*time.Minute))
+	if _, err := reloader.Reload(); err == nil {
+		t.Fatal("broken certificate should fail to reload")
+	}
+	if serial := servedSerial(t, reloader, "a.example.com"); serial != 3 {
+		t.Fatalf("after broken reload: got serial %d", serial)
+	}
+}
+
+func TestCertReloaderWatch(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	a := writeCert(t, dir, "a.example.com", 1, start)
+	reloader, err := lora_router.NewCertReloader([]lora_router.CertKeyPair{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go reloader.Watch(10*time.Millisecond, stop)
+	writeCert(t, dir, "a.example.com", 2, start.Add(time.Minute))
+	deadline := time.Now().Add(2 * time.Second)
+	for servedSerial(t, reloader, "a.example.com") != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch did not pick up the renewed certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Watch和手动调用Reload同时进行，需要使用-race运行
+func TestCertReloaderConcurrentReload(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Now().Add(-time.Hour)
+	a := writeCert(t, dir, "a.example.com", 1, start)
+	reloader, err := lora_router.NewCertReloader([]lora_router.CertKeyPair{a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	go reloader.Watch(time.Millisecond, stop)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if _, err := reloader.Reload(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	if serial := servedSerial(t, reloader, "a.example.com"); serial != 1 {
+		t.Fatalf("got serial %d", serial)
+	}
+}
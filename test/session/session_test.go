@@ -0,0 +1,171 @@
+package session
+
+import (
+	"errors"
+	"github.com/LorraineWen/lorago/lora_session"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var key = []byte("0123456789abcdef0123456789abcdef")
+
+// 保存Session，返回响应中的cookie
+func save(t *testing.T, store lora_session.Store, s *lora_session.Session) []*http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := store.Save(w, s); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies()
+}
+
+func load(t *testing.T, store lora_session.Store, cookies []*http.Cookie) (*lora_session.Session, error) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	return store.Load(r)
+}
+
+func TestCookieStore(t *testing.T) {
+	store, err := lora_session.NewCookieStore(lora_session.Options{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := load(t, store, nil)
+	if cookies := save(t, store, s); len(cookies) != 0 {
+		t.Fatal("empty new session should not set a cookie")
+	}
+	s.Set("user_id", 7)
+	s.AddFlash("saved")
+	cookies := save(t, store, s)
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+	loaded, err := load(t, store, cookies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := loaded.Get("user_id"); !ok || v != 7 || loaded.IsNew() {
+		t.Fatalf("unexpected value %v", v)
+	}
+	if flashes := loaded.Flashes(); len(flashes) != 1 || flashes[0] != "saved" {
+		t.Fatalf("unexpected flashes %v", flashes)
+	}
+	if flashes := loaded.Flashes(); len(flashes) != 0 {
+		t.Fatal("flashes should be removed after reading")
+	}
+	tampered := *cookies[0]
+	tampered.Value = tampered.Value[:len(tampered.Value)-2] + "AA"
+	if s, err := load(t, store, []*http.Cookie{&tampered}); err == nil || !s.IsNew() {
+		t.Fatal("tampered cookie should be rejected")
+	}
+	//旧密钥加密的cookie在密钥轮换之后仍然可以解密
+	rotated, _ := lora_session.NewCookieStore(lora_session.Options{}, []byte("fedcba9876543210fedcba9876543210"), key)
+	if s, err := load(t, rotated, cookies); err != nil || s.IsNew() {
+		t.Fatalf("rotated key failed: %v", err)
+	}
+}
+
+func TestServerSideStore(t *testing.T) {
+	memory := lora_session.NewMemoryStore()
+	store := lora_session.NewServerSideStore(lora_session.Options{}, memory)
+	s, _ := load(t, store, nil)
+	s.Set("name", "amie")
+	cookies := save(t, store, s)
+	oldID := cookies[0].Value
+	loaded, _ := load(t, store, cookies)
+	if v, _ := loaded.Get("name"); v != "amie" {
+		t.Fatalf("unexpected value %v", v)
+	}
+	loaded.RegenerateID()
+	cookies = save(t, store, loaded)
+	if cookies[0].Value == oldID || memory.Len() != 1 {
+		t.Fatalf("regenerate id failed, %d sessions stored", memory.Len())
+	}
+	if s, _ := load(t, store, []*http.Cookie{{Name: "lora_session", Value: oldID}}); !s.IsNew() {
+		t.Fatal("old session id should be invalid")
+	}
+	loaded, _ = load(t, store, cookies)
+	loaded.Destroy()
+	cookies = save(t, store, loaded)
+	if cookies[0].MaxAge >= 0 || memory.Len() != 0 {
+		t.Fatal("destroy should delete the session")
+	}
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	store := lora_session.NewServerSideStore(lora_session.Options{IdleTimeout: 20 * time.Millisecond}, lora_session.NewMemoryStore())
+	s, _ := load(t, store, nil)
+	s.Set("name", "amie")
+	cookies := save(t, store, s)
+	time.Sleep(40 * time.Millisecond)
+	if s, _ := load(t, store, cookies); !s.IsNew() {
+		t.Fatal("idle session should expire")
+	}
+}
+
+// 存储不可用的服务端存储
+type brokenStore struct{}
+
+func (brokenStore) Get(id string) ([]byte, bool, error) {
+	return nil, false, errors.New("store unavailable")
+}
+
+func (brokenStore) Set(id string, data []byte, ttl time.Duration) error {
+	return errors.New("store unavailable")
+}
+
+func (brokenStore) Delete(id string) error {
+	return errors.New("store unavailable")
+}
+
+// 失效的cookie在保存时删除，存储不可用时保留cookie
+func TestStaleCookieCleared(t *testing.T) {
+	cookieStore, err := lora_session.NewCookieStore(lora_session.Options{IdleTimeout: 20 * time.Millisecond}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverStore := lora_session.NewServerSideStore(lora_session.Options{}, lora_session.NewMemoryStore())
+	newCookies := func(store lora_session.Store) []*http.Cookie {
+		s, _ := load(t, store, nil)
+		s.Set("name", "amie")
+		return save(t, store, s)
+	}
+	expired := newCookies(cookieStore)
+	time.Sleep(40 * time.Millisecond)
+	tampered := *newCookies(cookieStore)[0]
+	first := "A"
+	if tampered.Value[:1] == first {
+		first = "B"
+	}
+	tampered.Value = first + tampered.Value[1:]
+	cases := []struct {
+		name    string
+		store   lora_session.Store
+		cookies []*http.Cookie
+		cleared bool
+	}{
+		{"expired cookie", cookieStore, expired, true},
+		{"tampered cookie", cookieStore, []*http.Cookie{&tampered}, true},
+		{"no cookie", cookieStore, nil, false},
+		{"unknown server session", serverStore, []*http.Cookie{{Name: "lora_session", Value: "missing"}}, true},
+		{"store unavailable", lora_session.NewServerSideStore(lora_session.Options{}, brokenStore{}), []*http.Cookie{{Name: "lora_session", Value: "id"}}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, _ := load(t, c.store, c.cookies)
+			if !s.IsNew() {
+				t.Fatal("expected a new session")
+			}
+			cookies := save(t, c.store, s)
+			cleared := len(cookies) == 1 && cookies[0].MaxAge < 0 && cookies[0].Value == ""
+			if cleared != c.cleared || (!c.cleared && len(cookies) != 0) {
+				t.Fatalf("cleared %v, want %v, cookies %v", cleared, c.cleared, cookies)
+			}
+		})
+	}
+}
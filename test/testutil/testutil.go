@@ -0,0 +1,78 @@
+package testutil
+
+import (
+	"github.com/LorraineWen/lorago/lora_router"
+	"github.com/LorraineWen/lorago/lora_session"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+/*
+*@Author: LorraineWen
+*各个测试包公用的辅助函数
+*创建只注册了一个路由的engine，构造请求并返回响应记录，避免每个测试文件各写一份
+ */
+// 测试使用的固定会话密钥
+var SessionKey = []byte("0123456789abcdef0123456789abcdef")
+
+// 创建只有一个路由的engine，route是完整的请求路径，第一段作为路由组，比如/user/list
+// 所有请求方法都交给handle处理，middlewares是路由级别的中间件，后注册的先执行
+// 调用方式:engine := testutil.NewEngine("/user/list", listHandler, cache.CacheMiddleware)
+func NewEngine(route string, handle lora_router.HandleFunc, middlewares ...lora_router.MiddlewareFunc) *lora_router.Engine {
+	group, path, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+	engine := lora_router.New()
+	engine.Group(group).Any("/"+path, handle, middlewares...)
+	return engine
+}
+
+// 通过handler处理一个请求，返回响应记录
+func Serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// 发起一个GET请求，header中的值设置为请求头
+func Get(handler http.Handler, target string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for key, value := range header {
+		r.Header.Set(key, value)
+	}
+	return Serve(handler, r)
+}
+
+// 创建一个application/x-www-form-urlencoded格式提交表单的POST请求
+func NewFormRequest(target string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// 把handle注册到请求的路径上，处理请求r，用于在handler中直接测试Context
+// 调用方式:testutil.Handle(httptest.NewRequest(http.MethodGet, "/q/values?page=1", nil), func(ctx *lora_router.Context) {...})
+func Handle(r *http.Request, handle lora_router.HandleFunc) *httptest.ResponseRecorder {
+	return Serve(NewEngine(r.URL.Path, handle), r)
+}
+
+// 日志中间件，把请求处理过程中的错误信息记录到logged中
+func LogError(logged *string) lora_router.MiddlewareFunc {
+	return func(next lora_router.HandleFunc) lora_router.HandleFunc {
+		return lora_router.LoggerWithConfig(lora_router.LoggerConfig{Formatter: func(params lora_router.LogFormatterParams) string {
+			*logged = params.ErrorMessage()
+			return ""
+		}}, next)
+	}
+}
+
+// 使用SessionKey创建cookie会话存储
+func NewCookieStore(t testing.TB) *lora_session.CookieStore {
+	t.Helper()
+	store, err := lora_session.NewCookieStore(lora_session.Options{}, SessionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
@@ -0,0 +1,119 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/LorraineWen/lorago/lora_upload"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n0000")
+
+func newForm(t *testing.T, files map[string][][2]string) *multipart.Form {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for field, list := range files {
+		for _, f := range list {
+			part, err := w.CreateFormFile(field, f[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write([]byte(f[1]))
+		}
+	}
+	w.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	return req.MultipartForm
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	cases := map[string]string{
+		"../../etc/passwd":      "passwd",
+		`C:\Users\amie\a b.png`: "a b.png",
+		"报表<1>.xlsx":            "报表_1_.xlsx",
+		"..":                    "file",
+		"a\x00b.txt":            "ab.txt",
+	}
+	for name, want := range cases {
+		if got := lora_upload.SanitizeFilename(name); got != want {
+			t.Fatalf("%q: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestUploaderSave(t *testing.T) {
+	dir := t.TempDir()
+	uploader := &lora_upload.Uploader{
+		Storage: &lora_upload.LocalStorage{Dir: dir},
+		Rules: map[string]lora_upload.Rule{
+			"avatar": {MaxSize: 64, AllowedTypes: []string{"image/*"}},
+		},
+		KeyFunc: func(field, filename string) string { return field + "/" + filename },
+	}
+	form := newForm(t, map[string][][2]string{"avatar": {{"../me.png", string(pngHeader)}}})
+	results, err := uploader.SaveAll(context.Background(), form, "avatar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(pngHeader)
+	result := results[0]
+	if result.Filename != "me.png" || result.ContentType != "image/png" || result.Size != int64(len(pngHeader)) || result.Hash != hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "avatar", "me.png"))
+	if err != nil || !bytes.Equal(data, pngHeader) {
+		t.Fatalf("unexpected saved file %q, %v", data, err)
+	}
+}
+
+func TestUploaderRejects(t *testing.T) {
+	dir := t.TempDir()
+	uploader := &lora_upload.Uploader{
+		Storage: &lora_upload.LocalStorage{Dir: dir},
+		Rules: map[string]lora_upload.Rule{
+			"avatar": {MaxSize: 16, AllowedTypes: []string{"image/png"}},
+		},
+		KeyFunc: func(field, filename string) string { return filename },
+	}
+	cases := []struct {
+		files  [][2]string
+		status int
+	}{
+		{[][2]string{{"a.png", "plain text"}}, http.StatusUnsupportedMediaType},
+		{[][2]string{{"a.png", string(pngHeader) + "0123456789"}}, http.StatusRequestEntityTooLarge},
+		{[][2]string{{"ok.png", string(pngHeader)}, {"b.png", "plain text"}}, http.StatusUnsupportedMediaType},
+	}
+	for _, c := range cases {
+		form := newForm(t, map[string][][2]string{"avatar": c.files})
+		_, err := uploader.SaveAll(context.Background(), form)
+		var uploadErr *lora_upload.UploadError
+		if !errors.As(err, &uploadErr) || uploadErr.StatusCode() != c.status {
+			t.Fatalf("expected status %d, got %v", c.status, err)
+		}
+	}
+	//失败时已经保存的文件会被删除
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("expected rollback, found %d files", len(entries))
+	}
+}
+
+func TestLocalStorageRejectsTraversal(t *testing.T) {
+	storage := &lora_upload.LocalStorage{Dir: t.TempDir()}
+	_, err := storage.Save(context.Background(), "../escape.txt", bytes.NewReader(nil), lora_upload.FileInfo{})
+	if !errors.Is(err, lora_upload.ErrInvalidKey) {
+		t.Fatalf("expected invalid key, got %v", err)
+	}
+}